@@ -0,0 +1,186 @@
+package db
+
+import (
+	"reflect"
+)
+
+// GroupBy groups matching rows by given columns, so that aggregates are
+// computed for every group (see Aggregate).
+func (q *Query) GroupBy(columns ...string) *Query {
+	q.group = append(q.group, columns...)
+	return q
+}
+
+// Having adds condition that groups must match. It is given the same way as
+// to Where.
+func (q *Query) Having(cond interface{}, vals ...interface{}) *Query {
+	if c := q.cond(cond, vals); c != nil {
+		q.having = append(q.having, c)
+	}
+	return q
+}
+
+// Sum stores sum of column values of matching rows in dest, which must be
+// a pointer. Sum of no rows is zero.
+func (q *Query) Sum(column string, dest interface{}) error {
+	return q.scalar("SUM", column, dest)
+}
+
+// Avg stores average of column values of matching rows in dest, which must
+// be a pointer. ErrNotFound is returned if there are no such rows.
+func (q *Query) Avg(column string, dest interface{}) error {
+	return q.scalar("AVG", column, dest)
+}
+
+// Min stores the lowest column value of matching rows in dest, which must be
+// a pointer. ErrNotFound is returned if there are no such rows.
+func (q *Query) Min(column string, dest interface{}) error {
+	return q.scalar("MIN", column, dest)
+}
+
+// Max stores the highest column value of matching rows in dest, which must
+// be a pointer. ErrNotFound is returned if there are no such rows.
+func (q *Query) Max(column string, dest interface{}) error {
+	return q.scalar("MAX", column, dest)
+}
+
+func (q *Query) scalar(fn, column string, dest interface{}) error {
+	table, err := q.tableinfo()
+	if err != nil {
+		return err
+	}
+	destval := reflect.ValueOf(dest)
+	if destval.Kind() != reflect.Ptr || destval.IsNil() {
+		return ErrInvalidItem
+	}
+	sqlquery := newSQLBuilder(q.mapping.session.dialect)
+	sqlquery.write("SELECT ", fn, "(").column(column).write(") FROM ").ident(table.name)
+	q.clauses(table, sqlquery.joins(q.joins))
+	rows, err := q.query(sqlquery)
+	if err != nil {
+		q.mapping.session.log.Error("aggregate query error: %s\n%s", err, sqlquery)
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		// grouped query with no groups
+		if err := q.rowsErr(rows); err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+	// scan into pointer, so that NULL result of no rows can be detected
+	holder := reflect.New(destval.Type())
+	if err := rows.Scan(holder.Interface()); err != nil {
+		return err
+	}
+	if rows.Next() {
+		return ErrMultipleRowsFound
+	}
+	if err := q.rowsErr(rows); err != nil {
+		return err
+	}
+	if holder.Elem().IsNil() {
+		if fn != "SUM" {
+			return ErrNotFound
+		}
+		destval.Elem().Set(reflect.Zero(destval.Elem().Type()))
+		return nil
+	}
+	destval.Elem().Set(holder.Elem().Elem())
+	return nil
+}
+
+// Aggregate fetches one row for every group into dest, which must be pointer
+// to slice of structures. Selected are grouping columns followed by given
+// expressions, which should be named:
+//
+//	type UserPosts struct {
+//		UserId int64
+//		Posts  int64
+//	}
+//	rows := make([]UserPosts, 0)
+//	q.GroupBy("user_id").OrderDesc("posts").Aggregate(&rows, "COUNT(*) AS posts")
+//
+// Result columns are bound to struct fields the same way table columns are
+// (see structmap), every one of them must be bound.
+func (q *Query) Aggregate(dest interface{}, exprs ...string) error {
+	table, err := q.tableinfo()
+	if err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(dest)
+	for slice.Type().Kind() == reflect.Ptr {
+		slice = slice.Elem()
+	}
+	if slice.Type().Kind() != reflect.Slice {
+		q.mapping.session.log.Error(
+			"query Aggregate() destination is not slice (got %s)", slice.Type().Kind())
+		return ErrInvalidItem
+	}
+	itemTpIsPtr := false
+	itemTp := slice.Type().Elem()
+	if itemTp.Kind() == reflect.Ptr {
+		itemTpIsPtr = true
+		itemTp = itemTp.Elem()
+	}
+	if itemTp.Kind() != reflect.Struct {
+		q.mapping.session.log.Error(
+			"query Aggregate() destination is not slice of structures (slice of %s)", itemTp.Kind())
+		return ErrInvalidItem
+	}
+
+	sqlquery := newSQLBuilder(q.mapping.session.dialect)
+	sqlquery.write("SELECT ")
+	if q.distinct {
+		sqlquery.write("DISTINCT ")
+	}
+	for i, column := range q.group {
+		if i != 0 {
+			sqlquery.write(", ")
+		}
+		sqlquery.column(column)
+	}
+	for i, expr := range exprs {
+		if i != 0 || len(q.group) != 0 {
+			sqlquery.write(", ")
+		}
+		sqlquery.write(expr)
+	}
+	sqlquery.write(" FROM ").ident(table.name).joins(q.joins)
+	q.clauses(table, sqlquery)
+	rows, err := q.query(sqlquery)
+	if err != nil {
+		q.mapping.session.log.Error("aggregate query error: %s\n%s", err, sqlquery)
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	indexes, err := resultFields(itemTp, columns)
+	if err != nil {
+		q.mapping.session.log.Error("cannot bind aggregate result: %s", err)
+		return err
+	}
+	sqlargs := make([]interface{}, len(indexes))
+	for rows.Next() {
+		structval := reflect.New(itemTp)
+		for i, index := range indexes {
+			sqlargs[i] = structval.Elem().FieldByIndex(index).Addr().Interface()
+		}
+		if err := rows.Scan(sqlargs...); err != nil {
+			q.mapping.session.log.Error("cannot scan result row: %s", err)
+			return err
+		}
+		if itemTpIsPtr {
+			slice.Set(reflect.Append(slice, structval))
+		} else {
+			slice.Set(reflect.Append(slice, structval.Elem()))
+		}
+	}
+	return q.rowsErr(rows)
+}
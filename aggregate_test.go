@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+type UserPosts struct {
+	UserId int64
+	Count  int64 `db:"posts"`
+	Last   string
+}
+
+func TestQueryAggregates(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		var sum int64
+		if err := session.Table("users").Query().Sum("age", &sum); err != nil || sum != 112 {
+			t.Fatalf("expected sum of 112, got %d (%v)", sum, err)
+		}
+		if err := session.Table("users").Query().Where("age >", 100).Sum("age", &sum); err != nil || sum != 0 {
+			t.Fatalf("expected sum of no rows to be 0, got %d (%v)", sum, err)
+		}
+		var avg float64
+		if err := session.Table("users").Query().Where(In("id", []int{1, 2})).Avg("age", &avg); err != nil || avg != 28.5 {
+			t.Fatalf("expected average of 28.5, got %f (%v)", avg, err)
+		}
+		var min, max int
+		if err := session.Table("users").Query().Min("age", &min); err != nil || min != 25 {
+			t.Fatalf("expected min of 25, got %d (%v)", min, err)
+		}
+		if err := session.Table("users").Query().Max("users.age", &max); err != nil || max != 55 {
+			t.Fatalf("expected max of 55, got %d (%v)", max, err)
+		}
+		if err := session.Table("users").Query().Where("age >", 100).Max("age", &max); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected max of no rows to be not found, got %v", err)
+		}
+
+		rows := make([]UserPosts, 0)
+		q := session.Table("posts").Query().
+			GroupBy("user_id").
+			Having("COUNT(*) >", 0).
+			OrderDesc("posts").
+			OrderBy("user_id")
+		if err := q.Aggregate(&rows, "COUNT(*) AS posts", "MAX(title) AS last"); err != nil {
+			t.Fatalf("cannot aggregate posts: %s", err)
+		}
+		expected := []UserPosts{{1, 2, "second"}, {2, 1, "third"}, {99, 1, "orphan"}}
+		if len(rows) != len(expected) {
+			t.Fatalf("expected %d groups, got %#v", len(expected), rows)
+		}
+		for i, row := range rows {
+			if row != expected[i] {
+				t.Fatalf("expected %#v, got %#v", expected[i], row)
+			}
+		}
+
+		rows = rows[:0]
+		q = session.Table("posts").Query().GroupBy("user_id").Having(Expr("COUNT(*) >", 1))
+		if err := q.Aggregate(&rows, "COUNT(*) AS posts"); err != nil {
+			t.Fatalf("cannot aggregate posts: %s", err)
+		}
+		if len(rows) != 1 || rows[0].UserId != 1 || rows[0].Count != 2 {
+			t.Fatalf("unexpected groups: %#v", rows)
+		}
+		if count, err := q.Count(); err != nil || count != 1 {
+			t.Fatalf("expected 1 group, got %d (%v)", count, err)
+		}
+		posts := session.Table("posts")
+		if exists, err := posts.Query().GroupBy("user_id").Having(Expr("COUNT(*) >", 2)).Exists(); err != nil || exists {
+			t.Fatalf("expected no groups to exist, got %v (%v)", exists, err)
+		}
+		if count, err := posts.Query().Having(Expr("COUNT(*) >", 10)).Count(); err != nil || count != 0 {
+			t.Fatalf("expected no groups, got %d (%v)", count, err)
+		}
+		if count, err := posts.Query().Select("user_id").Distinct().Count(); err != nil || count != 3 {
+			t.Fatalf("expected 3 distinct authors, got %d (%v)", count, err)
+		}
+		if count, err := posts.Query().Distinct().Count(); err != nil || count != 4 {
+			t.Fatalf("expected 4 distinct posts, got %d (%v)", count, err)
+		}
+
+		err := session.Table("posts").Query().GroupBy("user_id").Aggregate(&rows, "COUNT(*) AS unknown")
+		if !errors.Is(err, ErrInvalidItem) {
+			t.Fatalf("expected invalid item error for unbound column, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// sqlbuilder renders SQL statements using dialect specific identifier
+// quoting, placeholders and paging. Statement arguments are collected in the
+// same order as their placeholders are written.
+type sqlbuilder struct {
+	dialect Dialect
+	chunks  []string
+	args    []interface{}
+}
+
+func newSQLBuilder(dialect Dialect) *sqlbuilder {
+	return &sqlbuilder{
+		dialect: dialect,
+		chunks:  make([]string, 0, 16),
+		args:    make([]interface{}, 0, 4),
+	}
+}
+
+func (b *sqlbuilder) String() string {
+	return strings.Join(b.chunks, "")
+}
+
+func (b *sqlbuilder) write(chunks ...string) *sqlbuilder {
+	b.chunks = append(b.chunks, chunks...)
+	return b
+}
+
+// ident writes quoted identifier
+func (b *sqlbuilder) ident(name string) *sqlbuilder {
+	b.chunks = append(b.chunks, b.dialect.Quote(name))
+	return b
+}
+
+// qualified writes quoted column name, qualified with table name
+func (b *sqlbuilder) qualified(table, column string) *sqlbuilder {
+	b.chunks = append(b.chunks, b.dialect.Quote(table), ".", b.dialect.Quote(column))
+	return b
+}
+
+// column writes quoted column name, which can be qualified with table name
+// separated by dot
+func (b *sqlbuilder) column(name string) *sqlbuilder {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		return b.qualified(name[:i], name[i+1:])
+	}
+	return b.ident(name)
+}
+
+// columns writes comma separated list of column names (see column)
+func (b *sqlbuilder) columns(names []string) *sqlbuilder {
+	for i, name := range names {
+		if i != 0 {
+			b.chunks = append(b.chunks, ", ")
+		}
+		b.column(name)
+	}
+	return b
+}
+
+// idents writes comma separated list of quoted identifiers
+func (b *sqlbuilder) idents(names []string) *sqlbuilder {
+	for i, name := range names {
+		if i != 0 {
+			b.chunks = append(b.chunks, ", ")
+		}
+		b.ident(name)
+	}
+	return b
+}
+
+// arg writes placeholder for given value. Times are converted to format of
+// the dialect, so that they compare with stored ones (see
+// Dialect.FormatTime).
+func (b *sqlbuilder) arg(val interface{}) *sqlbuilder {
+	switch t := val.(type) {
+	case time.Time:
+		val = b.dialect.FormatTime(t)
+	case *time.Time:
+		if t != nil {
+			val = b.dialect.FormatTime(*t)
+		}
+	}
+	b.args = append(b.args, val)
+	b.chunks = append(b.chunks, b.dialect.Placeholder(len(b.args)))
+	return b
+}
+
+// arglist writes comma separated list of placeholders for given values
+func (b *sqlbuilder) arglist(vals []interface{}) *sqlbuilder {
+	for i, val := range vals {
+		if i != 0 {
+			b.chunks = append(b.chunks, ", ")
+		}
+		b.arg(val)
+	}
+	return b
+}
+
+func (b *sqlbuilder) selectFrom(table string, columns []string) *sqlbuilder {
+	b.write("SELECT ").idents(columns).write(" FROM ").ident(table)
+	return b
+}
+
+// joins writes JOIN clauses of given tables
+func (b *sqlbuilder) joins(joins []join) *sqlbuilder {
+	for _, j := range joins {
+		b.write(" ", j.kind, " ").ident(j.table).write(" ON ", j.on)
+	}
+	return b
+}
+
+// where writes conditions joined with AND
+func (b *sqlbuilder) where(conds []Cond) *sqlbuilder {
+	return b.conds(" WHERE ", conds)
+}
+
+// having writes conditions of groups joined with AND
+func (b *sqlbuilder) having(conds []Cond) *sqlbuilder {
+	return b.conds(" HAVING ", conds)
+}
+
+func (b *sqlbuilder) conds(clause string, conds []Cond) *sqlbuilder {
+	for i, cond := range conds {
+		if i == 0 {
+			b.write(clause)
+		} else {
+			b.write(" AND ")
+		}
+		cond.render(b)
+	}
+	return b
+}
+
+// whereEq writes conditions testing equality of every given column
+func (b *sqlbuilder) whereEq(columns []string, vals []interface{}) *sqlbuilder {
+	for i, column := range columns {
+		if i == 0 {
+			b.write(" WHERE ")
+		} else {
+			b.write(" AND ")
+		}
+		b.ident(column).write(" = ").arg(vals[i])
+	}
+	return b
+}
+
+func (b *sqlbuilder) groupBy(columns []string) *sqlbuilder {
+	for i, name := range columns {
+		if i == 0 {
+			b.write(" GROUP BY ")
+		} else {
+			b.write(", ")
+		}
+		b.column(name)
+	}
+	return b
+}
+
+func (b *sqlbuilder) orderBy(asc, desc []string) *sqlbuilder {
+	if len(asc) == 0 && len(desc) == 0 {
+		return b
+	}
+	b.write(" ORDER BY ")
+	for i, name := range asc {
+		if i != 0 {
+			b.write(", ")
+		}
+		b.column(name).write(" ASC")
+	}
+	for i, name := range desc {
+		if i != 0 || len(asc) != 0 {
+			b.write(", ")
+		}
+		b.column(name).write(" DESC")
+	}
+	return b
+}
+
+func (b *sqlbuilder) paging(limit, offset int64) *sqlbuilder {
+	b.write(b.dialect.Paging(limit, offset))
+	return b
+}
+
+// insert writes INSERT statement. If returning is not empty, statement is
+// extended to return value of that column, if dialect supports it.
+func (b *sqlbuilder) insert(table string, columns []string, vals []interface{}, returning string) *sqlbuilder {
+	return b.insertRows(table, columns, 1, vals).returning(returning)
+}
+
+// insertRows writes INSERT statement of multiple rows, values of which are
+// given one row after another.
+func (b *sqlbuilder) insertRows(table string, columns []string, rows int, vals []interface{}) *sqlbuilder {
+	b.write("INSERT INTO ").ident(table).write("(").idents(columns).write(") VALUES")
+	n := len(vals) / rows
+	for i := 0; i < rows; i++ {
+		if i != 0 {
+			b.write(", ")
+		}
+		b.write("(").arglist(vals[i*n : (i+1)*n]).write(")")
+	}
+	return b
+}
+
+// returning writes clause returning value of given column from INSERT, if
+// column is not empty and dialect supports it
+func (b *sqlbuilder) returning(column string) *sqlbuilder {
+	if column != "" {
+		b.write(b.dialect.Returning(column))
+	}
+	return b
+}
+
+// update writes UPDATE statement without WHERE clause
+func (b *sqlbuilder) update(table string, columns []string, vals []interface{}) *sqlbuilder {
+	b.write("UPDATE ").ident(table).write(" SET ")
+	for i, column := range columns {
+		if i != 0 {
+			b.write(", ")
+		}
+		b.ident(column).write(" = ").arg(vals[i])
+	}
+	return b
+}
+
+// delete writes DELETE statement without WHERE clause
+func (b *sqlbuilder) delete(table string) *sqlbuilder {
+	b.write("DELETE FROM ").ident(table)
+	return b
+}
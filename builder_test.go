@@ -0,0 +1,140 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestSQLBuilder(t *testing.T) {
+	dialects := []struct {
+		name    string
+		dialect Dialect
+	}{
+		{"sqlite3", &sqlite3Dialect{}},
+		{"postgres", &postgresDialect{}},
+		{"mysql", &mysqlDialect{}},
+	}
+
+	cases := []struct {
+		name     string
+		build    func(*sqlbuilder)
+		expected []string
+		args     int
+	}{
+		{
+			name: "select",
+			build: func(b *sqlbuilder) {
+				b.selectFrom("users", []string{"id", "name"})
+				b.where([]Cond{Expr("name =", "bob"), Expr("age >", 20)})
+				b.orderBy([]string{"name"}, []string{"age"})
+				b.paging(10, 20)
+			},
+			expected: []string{
+				`SELECT "id", "name" FROM "users" WHERE name = ? AND age > ? ORDER BY "name" ASC, "age" DESC LIMIT 10 OFFSET 20`,
+				`SELECT "id", "name" FROM "users" WHERE name = $1 AND age > $2 ORDER BY "name" ASC, "age" DESC LIMIT 10 OFFSET 20`,
+				"SELECT `id`, `name` FROM `users` WHERE name = ? AND age > ? ORDER BY `name` ASC, `age` DESC LIMIT 20, 10",
+			},
+			args: 2,
+		},
+		{
+			name: "offset without limit",
+			build: func(b *sqlbuilder) {
+				b.selectFrom("users", []string{"id"}).orderBy(nil, []string{"id"}).paging(-1, 5)
+			},
+			expected: []string{
+				`SELECT "id" FROM "users" ORDER BY "id" DESC LIMIT -1 OFFSET 5`,
+				`SELECT "id" FROM "users" ORDER BY "id" DESC OFFSET 5`,
+				"SELECT `id` FROM `users` ORDER BY `id` DESC LIMIT 5, 18446744073709551615",
+			},
+		},
+		{
+			name: "insert",
+			build: func(b *sqlbuilder) {
+				b.insert("users", []string{"name", "age"}, []interface{}{"bob", 20}, "id")
+			},
+			expected: []string{
+				`INSERT INTO "users"("name", "age") VALUES(?, ?)`,
+				`INSERT INTO "users"("name", "age") VALUES($1, $2) RETURNING "id"`,
+				"INSERT INTO `users`(`name`, `age`) VALUES(?, ?)",
+			},
+			args: 2,
+		},
+		{
+			name: "update",
+			build: func(b *sqlbuilder) {
+				b.update("users", []string{"name", "age"}, []interface{}{"bob", 20})
+				b.whereEq([]string{"id"}, []interface{}{1})
+			},
+			expected: []string{
+				`UPDATE "users" SET "name" = ?, "age" = ? WHERE "id" = ?`,
+				`UPDATE "users" SET "name" = $1, "age" = $2 WHERE "id" = $3`,
+				"UPDATE `users` SET `name` = ?, `age` = ? WHERE `id` = ?",
+			},
+			args: 3,
+		},
+		{
+			name: "delete",
+			build: func(b *sqlbuilder) {
+				b.delete("users").whereEq([]string{"id"}, []interface{}{1})
+			},
+			expected: []string{
+				`DELETE FROM "users" WHERE "id" = ?`,
+				`DELETE FROM "users" WHERE "id" = $1`,
+				"DELETE FROM `users` WHERE `id` = ?",
+			},
+			args: 1,
+		},
+		{
+			name: "conditions",
+			build: func(b *sqlbuilder) {
+				b.selectFrom("users", []string{"id"}).where([]Cond{
+					Or(Eq("name", "bob"), In("users.age", []int{20, 30})),
+					Not(IsNull("name")),
+					Between("age", 18, 65),
+					In("id", []int{}),
+					Expr("id IN", 1, 2),
+				})
+			},
+			expected: []string{
+				`SELECT "id" FROM "users" WHERE ("name" = ? OR "users"."age" IN (?, ?)) AND NOT ("name" IS NULL) AND "age" BETWEEN ? AND ? AND 1 = 0 AND id IN (?, ?)`,
+				`SELECT "id" FROM "users" WHERE ("name" = $1 OR "users"."age" IN ($2, $3)) AND NOT ("name" IS NULL) AND "age" BETWEEN $4 AND $5 AND 1 = 0 AND id IN ($6, $7)`,
+				"SELECT `id` FROM `users` WHERE (`name` = ? OR `users`.`age` IN (?, ?)) AND NOT (`name` IS NULL) AND `age` BETWEEN ? AND ? AND 1 = 0 AND id IN (?, ?)",
+			},
+			args: 7,
+		},
+		{
+			name: "column quoting",
+			build: func(b *sqlbuilder) {
+				b.selectFrom("users", []string{"id"}).orderBy([]string{"age); DROP TABLE users; --(age)"}, nil)
+			},
+			expected: []string{
+				`SELECT "id" FROM "users" ORDER BY "age); DROP TABLE users; --(age)" ASC`,
+				`SELECT "id" FROM "users" ORDER BY "age); DROP TABLE users; --(age)" ASC`,
+				"SELECT `id` FROM `users` ORDER BY `age); DROP TABLE users; --(age)` ASC",
+			},
+		},
+		{
+			name: "quoting",
+			build: func(b *sqlbuilder) {
+				b.delete("we\"ird`table")
+			},
+			expected: []string{
+				`DELETE FROM "we""ird` + "`" + `table"`,
+				`DELETE FROM "we""ird` + "`" + `table"`,
+				"DELETE FROM `we\"ird``table`",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		for i, d := range dialects {
+			b := newSQLBuilder(d.dialect)
+			c.build(b)
+			if sql := b.String(); sql != c.expected[i] {
+				t.Errorf("%s (%s): expected\n%s\ngot\n%s", c.name, d.name, c.expected[i], sql)
+			}
+			if len(b.args) != c.args {
+				t.Errorf("%s (%s): expected %d arguments, got %d", c.name, d.name, c.args, len(b.args))
+			}
+		}
+	}
+}
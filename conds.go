@@ -0,0 +1,169 @@
+package db
+
+import (
+	"reflect"
+)
+
+// Cond is a condition of WHERE clause, accepted by Query.Where. Conditions
+// are built with Eq, In, IsNull, Between and similar functions and can be
+// combined with And, Or and Not, for example:
+//
+//	Or(Eq("name", "bob"), And(In("age", []int{20, 30}), Not(IsNull("email"))))
+//
+// Column names are quoted and can be qualified with table name, like
+// "users.name". Conditions on expressions, like "COUNT(*)", are given with
+// Expr.
+type Cond interface {
+	render(b *sqlbuilder)
+}
+
+// rawCond is condition written as is, followed by placeholders of its values
+type rawCond struct {
+	cond string
+	vals []interface{}
+}
+
+// Expr returns condition written as given, like "age > 20". Single value
+// is appended as placeholder after it, multiple values are appended as
+// parenthesized list of placeholders:
+//
+//	Expr("age >", 20)        // age > ?
+//	Expr("id IN", 1, 2, 3)   // id IN (?, ?, ?)
+func Expr(cond string, vals ...interface{}) Cond {
+	return &rawCond{cond: cond, vals: vals}
+}
+
+func (c *rawCond) render(b *sqlbuilder) {
+	b.write(c.cond)
+	switch len(c.vals) {
+	case 0:
+	case 1:
+		b.write(" ").arg(c.vals[0])
+	default:
+		b.write(" (").arglist(c.vals).write(")")
+	}
+}
+
+type cmpCond struct {
+	column string
+	op     string
+	val    interface{}
+}
+
+func Eq(column string, val interface{}) Cond { return &cmpCond{column, " = ", val} }
+func Ne(column string, val interface{}) Cond { return &cmpCond{column, " <> ", val} }
+func Lt(column string, val interface{}) Cond { return &cmpCond{column, " < ", val} }
+func Le(column string, val interface{}) Cond { return &cmpCond{column, " <= ", val} }
+func Gt(column string, val interface{}) Cond { return &cmpCond{column, " > ", val} }
+func Ge(column string, val interface{}) Cond { return &cmpCond{column, " >= ", val} }
+
+func (c *cmpCond) render(b *sqlbuilder) {
+	b.column(c.column).write(c.op).arg(c.val)
+}
+
+type inCond struct {
+	column string
+	vals   []interface{}
+}
+
+// In returns condition testing if column value is one of given values, which
+// must be a slice. Condition with no values is always false.
+func In(column string, vals interface{}) Cond {
+	c := &inCond{column: column}
+	rv := reflect.ValueOf(vals)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		c.vals = []interface{}{vals}
+		return c
+	}
+	c.vals = make([]interface{}, rv.Len())
+	for i := range c.vals {
+		c.vals[i] = rv.Index(i).Interface()
+	}
+	return c
+}
+
+func (c *inCond) render(b *sqlbuilder) {
+	if len(c.vals) == 0 {
+		b.write("1 = 0")
+		return
+	}
+	b.column(c.column).write(" IN (").arglist(c.vals).write(")")
+}
+
+type nullCond struct {
+	column string
+}
+
+func IsNull(column string) Cond {
+	return &nullCond{column}
+}
+
+func (c *nullCond) render(b *sqlbuilder) {
+	b.column(c.column).write(" IS NULL")
+}
+
+type betweenCond struct {
+	column   string
+	from, to interface{}
+}
+
+// Between returns condition testing if column value is in given inclusive
+// range.
+func Between(column string, from, to interface{}) Cond {
+	return &betweenCond{column, from, to}
+}
+
+func (c *betweenCond) render(b *sqlbuilder) {
+	b.column(c.column).write(" BETWEEN ").arg(c.from).write(" AND ").arg(c.to)
+}
+
+type notCond struct {
+	cond Cond
+}
+
+func Not(cond Cond) Cond {
+	return &notCond{cond}
+}
+
+func (c *notCond) render(b *sqlbuilder) {
+	b.write("NOT (")
+	c.cond.render(b)
+	b.write(")")
+}
+
+type groupCond struct {
+	op    string
+	conds []Cond
+	// rendered when there are no conditions
+	empty string
+}
+
+// And returns condition that is true if all given conditions are. It is
+// useful only for grouping within Or, as conditions passed to Query.Where
+// are joined with AND already.
+func And(conds ...Cond) Cond {
+	return &groupCond{" AND ", conds, "1 = 1"}
+}
+
+// Or returns condition that is true if any of given conditions is.
+func Or(conds ...Cond) Cond {
+	return &groupCond{" OR ", conds, "1 = 0"}
+}
+
+func (c *groupCond) render(b *sqlbuilder) {
+	switch len(c.conds) {
+	case 0:
+		b.write(c.empty)
+	case 1:
+		c.conds[0].render(b)
+	default:
+		b.write("(")
+		for i, cond := range c.conds {
+			if i != 0 {
+				b.write(c.op)
+			}
+			cond.render(b)
+		}
+		b.write(")")
+	}
+}
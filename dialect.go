@@ -2,16 +2,142 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 )
 
 type Dialect interface {
 	TableInfo(*sql.DB, string) (*tableinfo, error)
+	// Quote returns identifier (table or column name) quoted, so that it can
+	// be safely used in SQL statement.
+	Quote(name string) string
+	// Placeholder returns bind parameter marker for n-th (starting from 1)
+	// argument of the statement.
+	Placeholder(n int) string
+	// Returning returns clause that makes INSERT statement return value of
+	// given column or empty string if database does not support it and
+	// LastInsertId should be used instead.
+	Returning(column string) string
+	// Paging returns LIMIT/OFFSET clause. Negative value means that given
+	// part was not set.
+	Paging(limit, offset int64) string
+	// Upsert returns clause that makes INSERT of given columns update
+	// columns listed in update when row conflicts with existing one on
+	// conflict columns, or do nothing if update is empty.
+	Upsert(columns, conflict, update []string) string
+	// FormatTime returns value time is written as. All times written by
+	// table mappings are converted with it, so that they are stored in
+	// consistent format.
+	FormatTime(t time.Time) interface{}
+	// MaxParams returns the maximum number of bind parameters of single
+	// statement.
+	MaxParams() int
+	// Savepoint, ReleaseSavepoint and RollbackToSavepoint return statements
+	// managing savepoint of given name, used by nested transactions.
+	Savepoint(name string) string
+	ReleaseSavepoint(name string) string
+	RollbackToSavepoint(name string) string
+	// Retryable tells if given error is a transient failure, like lock
+	// contention or serialization failure, after which the whole transaction
+	// can be run again.
+	Retryable(err error) bool
+}
+
+// standardDialect implements SQL rendering methods of Dialect the way most
+// databases understand them. Dialects embed it and override only what differs.
+type standardDialect struct{}
+
+func (standardDialect) Quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (standardDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (standardDialect) Returning(column string) string {
+	return ""
+}
+
+func (standardDialect) Paging(limit, offset int64) string {
+	chunks := make([]string, 0, 2)
+	if limit > -1 {
+		chunks = append(chunks, fmt.Sprintf(" LIMIT %d", limit))
+	}
+	if offset > -1 {
+		chunks = append(chunks, fmt.Sprintf(" OFFSET %d", offset))
+	}
+	return strings.Join(chunks, "")
+}
+
+func (d standardDialect) Upsert(columns, conflict, update []string) string {
+	chunks := make([]string, 0, 4+4*len(update))
+	chunks = append(chunks, " ON CONFLICT")
+	if len(conflict) != 0 {
+		quoted := make([]string, len(conflict))
+		for i, column := range conflict {
+			quoted[i] = d.Quote(column)
+		}
+		chunks = append(chunks, " (", strings.Join(quoted, ", "), ")")
+	}
+	if len(update) == 0 {
+		return strings.Join(append(chunks, " DO NOTHING"), "")
+	}
+	chunks = append(chunks, " DO UPDATE SET ")
+	for i, column := range update {
+		if i != 0 {
+			chunks = append(chunks, ", ")
+		}
+		chunks = append(chunks, d.Quote(column), " = excluded.", d.Quote(column))
+	}
+	return strings.Join(chunks, "")
+}
+
+func (standardDialect) FormatTime(t time.Time) interface{} {
+	return t.UTC()
+}
+
+// MaxParams returns limit of SQLite before 3.32, which is the lowest of
+// common databases.
+func (standardDialect) MaxParams() int {
+	return 999
+}
+
+func (standardDialect) Savepoint(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (standardDialect) ReleaseSavepoint(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (standardDialect) RollbackToSavepoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// Retryable recognizes serialization failures and deadlocks of drivers
+// reporting SQLSTATE codes, like lib/pq and pgx.
+func (standardDialect) Retryable(err error) bool {
+	var state interface {
+		SQLState() string
+	}
+	if !errors.As(err, &state) {
+		return false
+	}
+	switch state.SQLState() {
+	case "40001", "40P01":
+		return true
+	}
+	return false
 }
 
 type tableinfo struct {
-	name    string
-	fields  []*tablefield
-	pkfield *tablefield
+	name   string
+	fields []*tablefield
+	// primary key columns, in order they are declared in the key
+	pkfields []*tablefield
 }
 
 type tablefield struct {
@@ -19,3 +145,13 @@ type tablefield struct {
 	dbname string
 	pk     bool
 }
+
+// has tells if table has column of given name
+func (t *tableinfo) has(column string) bool {
+	for _, f := range t.fields {
+		if f.dbname == column {
+			return true
+		}
+	}
+	return false
+}
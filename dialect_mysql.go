@@ -0,0 +1,154 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var MySQLDialect = &mysqlDialect{
+	tables: make(map[string]*tableinfo),
+}
+
+type mysqlDialect struct {
+	standardDialect
+	lock   sync.RWMutex
+	tables map[string]*tableinfo
+}
+
+func (d *mysqlDialect) TableInfo(db *sql.DB, name string) (*tableinfo, error) {
+	d.lock.RLock()
+	table, ok := d.tables[name]
+	d.lock.RUnlock()
+	if ok {
+		return table, nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if table, ok := d.tables[name]; ok {
+		return table, nil
+	}
+	res, err := db.Query("SHOW COLUMNS FROM " + d.Quote(name))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	table = &tableinfo{
+		name:   name,
+		fields: make([]*tablefield, 0),
+	}
+
+	// we don't care about those
+	var tp, null, defaultValue, extra interface{}
+	for res.Next() {
+		f := &tablefield{}
+		var key string
+		// Field, Type, Null, Key, Default, Extra
+		err := res.Scan(&f.dbname, &tp, &null, &key, &defaultValue, &extra)
+		if err != nil {
+			return nil, err
+		}
+		f.name = dashToCamel(f.dbname)
+		f.pk = key == "PRI"
+		table.fields = append(table.fields, f)
+		if f.pk {
+			table.pkfields = append(table.pkfields, f)
+		}
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	if len(table.pkfields) > 1 {
+		if err := d.orderPrimaryKey(db, table); err != nil {
+			return nil, err
+		}
+	}
+	d.tables[name] = table
+	return table, nil
+}
+
+// orderPrimaryKey sorts primary key columns of composite key in order they
+// are declared in the key, which SHOW COLUMNS does not tell.
+func (d *mysqlDialect) orderPrimaryKey(db *sql.DB, table *tableinfo) error {
+	res, err := db.Query(`
+		SELECT COLUMN_NAME
+		FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY ORDINAL_POSITION`, table.name)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	pkfields := make([]*tablefield, 0, len(table.pkfields))
+	for res.Next() {
+		var column string
+		if err := res.Scan(&column); err != nil {
+			return err
+		}
+		for _, f := range table.pkfields {
+			if f.dbname == column {
+				pkfields = append(pkfields, f)
+			}
+		}
+	}
+	if err := res.Err(); err != nil {
+		return err
+	}
+	if len(pkfields) == len(table.pkfields) {
+		table.pkfields = pkfields
+	}
+	return nil
+}
+
+func (d *mysqlDialect) Quote(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+// MySQL does not allow OFFSET without LIMIT, so the largest possible row
+// count has to be used instead.
+func (d *mysqlDialect) Paging(limit, offset int64) string {
+	switch {
+	case limit > -1 && offset > -1:
+		return fmt.Sprintf(" LIMIT %d, %d", offset, limit)
+	case limit > -1:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > -1:
+		return fmt.Sprintf(" LIMIT %d, 18446744073709551615", offset)
+	}
+	return ""
+}
+
+// MySQL always checks all unique keys, so conflict columns are not used.
+// There is no DO NOTHING either, so the first column is set to itself.
+func (d *mysqlDialect) Upsert(columns, conflict, update []string) string {
+	if len(update) == 0 {
+		return " ON DUPLICATE KEY UPDATE " + d.Quote(columns[0]) + " = " + d.Quote(columns[0])
+	}
+	chunks := make([]string, 0, 4*len(update))
+	for i, column := range update {
+		if i != 0 {
+			chunks = append(chunks, ", ")
+		}
+		chunks = append(chunks, d.Quote(column), " = VALUES(", d.Quote(column), ")")
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(chunks, "")
+}
+
+// prepared statement protocol uses 16 bit number of parameters
+func (d *mysqlDialect) MaxParams() int {
+	return 65535
+}
+
+// go-sql-driver/mysql is not imported here, so deadlock (1213) and lock wait
+// timeout (1205) errors are recognized by their messages
+func (d *mysqlDialect) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.HasPrefix(msg, "Error 1213") || strings.HasPrefix(msg, "Error 1205")
+}
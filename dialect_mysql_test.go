@@ -0,0 +1,140 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+func withMySQL(t *testing.T, fn func(*Session, *fakeDB)) {
+	withFakeConnection(t, func(db *sql.DB, fake *fakeDB) {
+		fake.on("SHOW COLUMNS FROM `users`",
+			[]string{"Field", "Type", "Null", "Key", "Default", "Extra"},
+			[]driver.Value{"id", "int(11)", "NO", "PRI", nil, "auto_increment"},
+			[]driver.Value{"name", "varchar(255)", "YES", "UNI", nil, ""},
+			[]driver.Value{"age", "int(11)", "YES", "", nil, ""})
+
+		dialect := &mysqlDialect{tables: make(map[string]*tableinfo)}
+		fn(Use(db, dialect), fake)
+	})
+}
+
+func TestMySQLTableInfo(t *testing.T) {
+	withMySQL(t, func(session *Session, fake *fakeDB) {
+		table, err := session.dialect.TableInfo(session.db, "users")
+		if err != nil {
+			t.Fatalf("cannot read table info: %s", err)
+		}
+		if len(table.fields) != 3 {
+			t.Fatalf("expected 3 fields, got %d", len(table.fields))
+		}
+		if len(table.pkfields) != 1 || table.pkfields[0].dbname != "id" {
+			t.Fatalf("invalid primary key: %#v", table.pkfields)
+		}
+		if table.fields[1].pk || table.fields[2].pk {
+			t.Fatal("only id column should be primary key")
+		}
+	})
+}
+
+func TestMySQLSave(t *testing.T) {
+	withMySQL(t, func(session *Session, fake *fakeDB) {
+		fake.on("INSERT INTO", nil).lastInsertId = 7
+
+		user := &User{Name: "jim"}
+		if _, err := session.Table("users").Save(user); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		expected := "INSERT INTO `users`(`name`) VALUES(?)"
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		if user.Id != 7 {
+			t.Fatalf("user.Id should be set from LastInsertId, got %d", user.Id)
+		}
+
+		if _, err := session.Table("users").Save(user); err != nil {
+			t.Fatalf("cannot update user: %s", err)
+		}
+		expected = "UPDATE `users` SET `name` = ? WHERE `id` = ?"
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+	})
+}
+
+func TestMySQLUpsert(t *testing.T) {
+	withMySQL(t, func(session *Session, fake *fakeDB) {
+		if err := session.Table("users").Upsert(&User{Id: 1, Name: "jim"}, "id"); err != nil {
+			t.Fatalf("cannot upsert user: %s", err)
+		}
+		expected := "INSERT INTO `users`(`id`, `name`) VALUES(?, ?) ON DUPLICATE KEY UPDATE `name` = VALUES(`name`)"
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+
+		conflict := Conflict{Columns: []string{"name"}, DoNothing: true}
+		if err := session.Table("users").UpsertWith(&User{Name: "jim"}, conflict); err != nil {
+			t.Fatalf("cannot upsert user: %s", err)
+		}
+		expected = "INSERT INTO `users`(`name`) VALUES(?) ON DUPLICATE KEY UPDATE `name` = `name`"
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+	})
+}
+
+func TestMySQLQuery(t *testing.T) {
+	withMySQL(t, func(session *Session, fake *fakeDB) {
+		fake.on("SELECT `id`, `name` FROM", []string{"id", "name"},
+			[]driver.Value{int64(1), "bob"})
+
+		cases := []struct {
+			query    *Query
+			expected string
+		}{
+			{
+				session.Table("users").Query().Limit(10),
+				"SELECT `id`, `name` FROM `users` LIMIT 10",
+			},
+			{
+				session.Table("users").Query().Limit(10).Offset(20).OrderDesc("age"),
+				"SELECT `id`, `name` FROM `users` ORDER BY `age` DESC LIMIT 20, 10",
+			},
+			{
+				session.Table("users").Query().Offset(5),
+				"SELECT `id`, `name` FROM `users` LIMIT 5, 18446744073709551615",
+			},
+		}
+		for _, c := range cases {
+			users := make([]*User, 0)
+			if err := c.query.All(&users); err != nil {
+				t.Fatalf("cannot query users: %s", err)
+			}
+			if last := fake.last(); last.query != c.expected {
+				t.Fatalf("expected %q, got %q", c.expected, last.query)
+			}
+		}
+
+		if _, err := session.Table("users").Query().Where("name =", "bob").Exists(); err != nil {
+			t.Fatalf("cannot check if user exists: %s", err)
+		}
+		expected := "SELECT 1 FROM `users` WHERE name = ? LIMIT 1"
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+
+		fake.on("UPDATE", nil).rowsAffected = 2
+		_, err := session.Table("users").Query().Where(Gt("age", 20)).Update(map[string]interface{}{
+			"name": "bob",
+			"age":  30,
+		})
+		if err != nil {
+			t.Fatalf("cannot update users: %s", err)
+		}
+		expected = "UPDATE `users` SET `age` = ?, `name` = ? WHERE `age` > ?"
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+	})
+}
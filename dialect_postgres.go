@@ -0,0 +1,120 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+var PostgresDialect = &postgresDialect{
+	tables: make(map[string]*tableinfo),
+}
+
+type postgresDialect struct {
+	standardDialect
+	lock   sync.RWMutex
+	tables map[string]*tableinfo
+}
+
+func (d *postgresDialect) TableInfo(db *sql.DB, name string) (*tableinfo, error) {
+	d.lock.RLock()
+	table, ok := d.tables[name]
+	d.lock.RUnlock()
+	if ok {
+		return table, nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if table, ok := d.tables[name]; ok {
+		return table, nil
+	}
+	pks, err := d.primaryKeys(db, name)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := db.Query(`
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	table = &tableinfo{
+		name:   name,
+		fields: make([]*tablefield, 0),
+	}
+	for res.Next() {
+		f := &tablefield{}
+		if err := res.Scan(&f.dbname); err != nil {
+			return nil, err
+		}
+		f.name = dashToCamel(f.dbname)
+		_, f.pk = pks[f.dbname]
+		table.fields = append(table.fields, f)
+	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	table.pkfields = make([]*tablefield, len(pks))
+	for _, f := range table.fields {
+		if f.pk {
+			table.pkfields[pks[f.dbname]] = f
+		}
+	}
+	for column, i := range pks {
+		if table.pkfields[i] == nil {
+			return nil, fmt.Errorf("%w: primary key column %s of table %s not found", ErrTableInfoError, column, name)
+		}
+	}
+	d.tables[name] = table
+	return table, nil
+}
+
+// primaryKeys returns names of primary key columns mapped to their position
+// in the key. Table is looked up in current schema, the same one columns are
+// read from.
+func (d *postgresDialect) primaryKeys(db *sql.DB, name string) (map[string]int, error) {
+	res, err := db.Query(`
+		SELECT a.attname
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE n.nspname = current_schema() AND c.relname = $1 AND i.indisprimary
+		ORDER BY array_position(i.indkey, a.attnum)`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	pks := make(map[string]int)
+	for res.Next() {
+		var column string
+		if err := res.Scan(&column); err != nil {
+			return nil, err
+		}
+		pks[column] = len(pks)
+	}
+	return pks, res.Err()
+}
+
+func (d *postgresDialect) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// lib/pq does not support LastInsertId, so generated key has to be returned
+// by the INSERT statement itself
+func (d *postgresDialect) Returning(column string) string {
+	return ` RETURNING ` + d.Quote(column)
+}
+
+// protocol uses 16 bit number of bind parameters
+func (d *postgresDialect) MaxParams() int {
+	return 65535
+}
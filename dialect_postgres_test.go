@@ -0,0 +1,219 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func withPostgres(t testing.TB, fn func(*Session, *fakeDB)) {
+	withFakeConnection(t, func(db *sql.DB, fake *fakeDB) {
+		fake.on("FROM pg_index", []string{"attname"},
+			[]driver.Value{"id"})
+		fake.on("FROM information_schema.columns", []string{"column_name"},
+			[]driver.Value{"id"}, []driver.Value{"name"}, []driver.Value{"age"})
+
+		dialect := &postgresDialect{tables: make(map[string]*tableinfo)}
+		fn(Use(db, dialect), fake)
+	})
+}
+
+func TestPostgresTableInfo(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		table, err := session.dialect.TableInfo(session.db, "users")
+		if err != nil {
+			t.Fatalf("cannot read table info: %s", err)
+		}
+		if len(table.fields) != 3 {
+			t.Fatalf("expected 3 fields, got %d", len(table.fields))
+		}
+		if len(table.pkfields) != 1 || table.pkfields[0].dbname != "id" || table.pkfields[0].name != "Id" {
+			t.Fatalf("invalid primary key: %#v", table.pkfields)
+		}
+		for _, f := range table.fields[1:] {
+			if f.pk {
+				t.Fatalf("%s should not be primary key", f.dbname)
+			}
+		}
+
+		// second call must be served from cache
+		fake.reset()
+		if _, err := session.dialect.TableInfo(session.db, "users"); err != nil {
+			t.Fatalf("cannot read table info: %s", err)
+		}
+		if queries := fake.queries(); len(queries) != 0 {
+			t.Fatalf("table info was not cached: %v", queries)
+		}
+
+		// key of table in another schema than columns are read from
+		fake.on("FROM information_schema.columns", []string{"column_name"},
+			[]driver.Value{"name"})
+		if _, err := session.dialect.TableInfo(session.db, "accounts"); !errors.Is(err, ErrTableInfoError) {
+			t.Fatalf("expected table info error, got %v", err)
+		}
+		if err := session.Table("accounts").Delete(&User{Id: 1}); err != ErrTableInfoError {
+			t.Fatalf("expected table info error, got %v", err)
+		}
+	})
+}
+
+func TestPostgresSave(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		fake.on("INSERT INTO", []string{"id"}, []driver.Value{int64(42)})
+
+		user := &User{Name: "jim"}
+		created, err := session.Table("users").Save(user)
+		if err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		if !created {
+			t.Fatal("user was saved, but not created")
+		}
+		expected := `INSERT INTO "users"("name") VALUES($1) RETURNING "id"`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		if user.Id != 42 {
+			t.Fatalf("user.Id should be set from RETURNING clause, got %d", user.Id)
+		}
+
+		user.Name = "jimmy"
+		if _, err := session.Table("users").Save(user); err != nil {
+			t.Fatalf("cannot update user: %s", err)
+		}
+		expected = `UPDATE "users" SET "name" = $1 WHERE "id" = $2`
+		last := fake.last()
+		if last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		if len(last.args) != 2 || last.args[0] != "jimmy" || last.args[1] != int64(42) {
+			t.Fatalf("invalid update arguments: %#v", last.args)
+		}
+
+		if err := session.Table("users").Delete(user); err != nil {
+			t.Fatalf("cannot delete user: %s", err)
+		}
+		expected = `DELETE FROM "users" WHERE "id" = $1`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+	})
+}
+
+func TestPostgresQuery(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		fake.on(`SELECT "id", "name" FROM`, []string{"id", "name"},
+			[]driver.Value{int64(1), "bob"})
+
+		users := make([]*User, 0)
+		q := session.Table("users").Query().Where("name =", "bob").Where("age >", 20)
+		if err := q.All(&users); err != nil {
+			t.Fatalf("cannot query users: %s", err)
+		}
+		expected := `SELECT "id", "name" FROM "users" WHERE name = $1 AND age > $2`
+		last := fake.last()
+		if last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		if len(last.args) != 2 || last.args[0] != "bob" || last.args[1] != int64(20) {
+			t.Fatalf("invalid query arguments: %#v", last.args)
+		}
+		if len(users) != 1 || users[0].Id != 1 || users[0].Name != "bob" {
+			t.Fatalf("unexpected result: %#v", users)
+		}
+	})
+}
+
+func TestPostgresInsertAll(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		fake.on("INSERT INTO", []string{"id"}, []driver.Value{int64(10)}, []driver.Value{int64(11)})
+
+		users := []*User{{Name: "jim"}, {Name: "tom"}, {Id: 5, Name: "ann"}}
+		if err := session.Table("users").InsertAll(users); err != nil {
+			t.Fatalf("cannot insert users: %s", err)
+		}
+		stmts := fake.queries()
+		expected := []string{
+			`INSERT INTO "users"("name") VALUES($1), ($2) RETURNING "id"`,
+			`INSERT INTO "users"("id", "name") VALUES($1, $2)`,
+		}
+		stmts = stmts[len(stmts)-2:]
+		for i, stmt := range stmts {
+			if stmt != expected[i] {
+				t.Fatalf("expected %q, got %q", expected[i], stmt)
+			}
+		}
+		if users[0].Id != 10 || users[1].Id != 11 || users[2].Id != 5 {
+			t.Fatalf("generated keys were not set: %d, %d, %d", users[0].Id, users[1].Id, users[2].Id)
+		}
+
+		// every inserted row must return its key
+		users = []*User{{Name: "bill"}, {Name: "joe"}, {Name: "sam"}}
+		if err := session.Table("users").InsertAll(users); !errors.Is(err, ErrIncompleteKey) {
+			t.Fatalf("expected incomplete key error, got %v", err)
+		}
+	})
+}
+
+func TestPostgresUpsert(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		fake.on("INSERT INTO", []string{"id"}, []driver.Value{int64(3)})
+
+		user := &User{Name: "jim"}
+		conflict := Conflict{Columns: []string{"id"}, Update: []string{"name"}}
+		if err := session.Table("users").UpsertWith(user, conflict); err != nil {
+			t.Fatalf("cannot upsert user: %s", err)
+		}
+		expected := `INSERT INTO "users"("name") VALUES($1) ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name" RETURNING "id"`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		if user.Id != 3 {
+			t.Fatalf("user.Id should be set from RETURNING clause, got %d", user.Id)
+		}
+
+		if err := session.Table("users").Upsert(&User{Name: "jim"}, "name"); err != nil {
+			t.Fatalf("cannot upsert user: %s", err)
+		}
+		expected = `INSERT INTO "users"("name") VALUES($1) ON CONFLICT ("name") DO NOTHING RETURNING "id"`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+	})
+}
+
+func TestPostgresSavepoints(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		err := session.Transaction(func(s *Session) error {
+			s.Transaction(func(s *Session) error {
+				return ErrNotFound
+			})
+			return s.Transaction(func(s *Session) error {
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("transaction failed: %s", err)
+		}
+		expected := []string{
+			"BEGIN",
+			"SAVEPOINT sp1",
+			"ROLLBACK TO SAVEPOINT sp1",
+			"RELEASE SAVEPOINT sp1",
+			"SAVEPOINT sp2",
+			"RELEASE SAVEPOINT sp2",
+			"COMMIT",
+		}
+		fake.lock.Lock()
+		defer fake.lock.Unlock()
+		if len(fake.stmts) != len(expected) {
+			t.Fatalf("expected %d statements, got %d", len(expected), len(fake.stmts))
+		}
+		for i, stmt := range fake.stmts {
+			if stmt.query != expected[i] {
+				t.Fatalf("expected %q, got %q", expected[i], stmt.query)
+			}
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -18,6 +19,7 @@ var Sqlite3Dialect = &sqlite3Dialect{
 }
 
 type sqlite3Dialect struct {
+	standardDialect
 	lock   sync.RWMutex
 	tables map[string]*tableinfo
 }
@@ -32,6 +34,9 @@ func (d *sqlite3Dialect) TableInfo(db *sql.DB, name string) (*tableinfo, error)
 
 	d.lock.Lock()
 	defer d.lock.Unlock()
+	if table, ok := d.tables[name]; ok {
+		return table, nil
+	}
 	sql := fmt.Sprintf("pragma table_info(%s)", name)
 	res, err := db.Query(sql)
 	if err != nil {
@@ -46,22 +51,68 @@ func (d *sqlite3Dialect) TableInfo(db *sql.DB, name string) (*tableinfo, error)
 
 	// we don't care about those
 	var cid, notNull, tp, defaultValue interface{}
+	// position of column in primary key, starting from 1
+	pks := make(map[int]*tablefield)
 	for res.Next() {
 		f := &tablefield{}
+		var pk int
 		// cid, name, type, notnull, dflt_value, pk
-		err := res.Scan(&cid, &f.dbname, &tp, &notNull, &defaultValue, &f.pk)
+		err := res.Scan(&cid, &f.dbname, &tp, &notNull, &defaultValue, &pk)
 		if err != nil {
 			return nil, err
 		}
 		f.name = dashToCamel(f.dbname)
+		f.pk = pk > 0
 		table.fields = append(table.fields, f)
 		if f.pk {
-			table.pkfield = f
+			pks[pk] = f
 		}
 	}
+	if err := res.Err(); err != nil {
+		return nil, err
+	}
+	for i := 1; i <= len(pks); i++ {
+		table.pkfields = append(table.pkfields, pks[i])
+	}
+	d.tables[name] = table
 	return table, nil
 }
 
+// OFFSET is allowed only together with LIMIT, where negative LIMIT means no
+// upper bound
+func (d *sqlite3Dialect) Paging(limit, offset int64) string {
+	switch {
+	case limit > -1 && offset > -1:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset)
+	case limit > -1:
+		return fmt.Sprintf(" LIMIT %d", limit)
+	case offset > -1:
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset)
+	}
+	return ""
+}
+
+// go-sqlite3 is not imported here, so SQLITE_BUSY and SQLITE_LOCKED errors
+// are recognized by their messages
+func (d *sqlite3Dialect) Retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") ||
+		strings.Contains(msg, "database table is locked")
+}
+
+// sqlite3TimeFormat is the first of formats go-sqlite3 parses values of
+// TIMESTAMP and DATETIME columns with
+const sqlite3TimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// SQLite has no time type, so times are stored as text in UTC, which keeps
+// them comparable.
+func (d *sqlite3Dialect) FormatTime(t time.Time) interface{} {
+	return t.UTC().Format(sqlite3TimeFormat)
+}
+
 func dashToCamel(s string) string {
 	camel := rxDash.ReplaceAllStringFunc(s, func(m string) string {
 		return strings.ToUpper(m[1:])
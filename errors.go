@@ -17,4 +17,11 @@ var (
 	ErrInvalidItem       = &Error{"invalid mapping item"}
 	ErrNotFound          = &Error{"not found"}
 	ErrMultipleRowsFound = &Error{"multiple rows found"}
+	ErrIncompleteKey     = &Error{"primary key is incomplete"}
+	ErrInvalidRelation   = &Error{"invalid relation"}
+	ErrInvalidCondition  = &Error{"invalid condition"}
+	ErrInvalidQuery      = &Error{"invalid query"}
+	// ErrStaleObject is returned when saved item was modified or deleted
+	// since it was loaded, see structmap
+	ErrStaleObject = &Error{"stale object"}
 )
@@ -0,0 +1,258 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a database/sql driver that never talks to a server. It
+// records every statement it receives and answers queries with canned rows,
+// so that dialects of databases we cannot run in tests can still be checked.
+type fakeDriver struct{}
+
+var (
+	fakeLock sync.Mutex
+	fakeDBs  = make(map[string]*fakeDB)
+)
+
+func init() {
+	sql.Register("fakedb", fakeDriver{})
+}
+
+type fakeDB struct {
+	lock      sync.Mutex
+	stmts     []fakeStmt
+	responses []*fakeResponse
+}
+
+type fakeStmt struct {
+	query string
+	args  []driver.Value
+}
+
+type fakeResponse struct {
+	match        string
+	columns      []string
+	rows         [][]driver.Value
+	lastInsertId int64
+	rowsAffected int64
+	err          error
+}
+
+// withFakeConnection opens a fresh fake database, independent from any other
+// test.
+func withFakeConnection(t testing.TB, fn func(*sql.DB, *fakeDB)) {
+	dsn := fmt.Sprintf("fake.%d", time.Now().UnixNano())
+	fake := &fakeDB{}
+	fakeLock.Lock()
+	fakeDBs[dsn] = fake
+	fakeLock.Unlock()
+
+	db, err := sql.Open("fakedb", dsn)
+	if err != nil {
+		t.Fatalf("cannot create fake database: %s", err)
+	}
+	defer db.Close()
+	fn(db, fake)
+}
+
+// on registers response for every statement containing match. Last
+// registered response wins.
+func (f *fakeDB) on(match string, columns []string, rows ...[]driver.Value) *fakeResponse {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	resp := &fakeResponse{
+		match:        match,
+		columns:      columns,
+		rows:         rows,
+		rowsAffected: 1,
+	}
+	f.responses = append(f.responses, resp)
+	return resp
+}
+
+func (f *fakeDB) respond(query string, args []driver.Value) *fakeResponse {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.stmts = append(f.stmts, fakeStmt{query: query, args: args})
+	for i := len(f.responses) - 1; i >= 0; i-- {
+		if strings.Contains(query, f.responses[i].match) {
+			return f.responses[i]
+		}
+	}
+	return &fakeResponse{rowsAffected: 1}
+}
+
+// queries returns all recorded statements, skipping transaction control.
+func (f *fakeDB) queries() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	queries := make([]string, 0, len(f.stmts))
+	for _, s := range f.stmts {
+		switch s.query {
+		case "BEGIN", "COMMIT", "ROLLBACK":
+			continue
+		}
+		queries = append(queries, s.query)
+	}
+	return queries
+}
+
+// last returns the most recently recorded statement.
+func (f *fakeDB) last() fakeStmt {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if len(f.stmts) == 0 {
+		return fakeStmt{}
+	}
+	return f.stmts[len(f.stmts)-1]
+}
+
+func (f *fakeDB) reset() {
+	f.lock.Lock()
+	f.stmts = nil
+	f.lock.Unlock()
+}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakeLock.Lock()
+	defer fakeLock.Unlock()
+	db, ok := fakeDBs[dsn]
+	if !ok {
+		return nil, fmt.Errorf("fake database %q not found", dsn)
+	}
+	return &fakeConn{db: db}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeDriverStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.db.respond("BEGIN", nil)
+	return &fakeTx{conn: c}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resp := c.db.respond(query, namedValues(args))
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return fakeExecResult{lastInsertId: resp.lastInsertId, rowsAffected: resp.rowsAffected}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	resp := c.db.respond(query, namedValues(args))
+	if resp.err != nil {
+		return nil, resp.err
+	}
+	return &fakeRows{columns: resp.columns, rows: resp.rows}, nil
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+type fakeTx struct {
+	conn *fakeConn
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.conn.db.respond("COMMIT", nil)
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.db.respond("ROLLBACK", nil)
+	return nil
+}
+
+type fakeDriverStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeDriverStmt) Close() error {
+	return nil
+}
+
+func (s *fakeDriverStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeDriverStmt) Exec(args []driver.Value) (driver.Result, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.conn.ExecContext(context.Background(), s.query, named)
+}
+
+func (s *fakeDriverStmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return s.conn.QueryContext(context.Background(), s.query, named)
+}
+
+type fakeExecResult struct {
+	lastInsertId int64
+	rowsAffected int64
+}
+
+func (r fakeExecResult) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r fakeExecResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	pos     int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
@@ -0,0 +1,422 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// structmap describes how table columns are bound to fields of a struct
+// type.
+//
+// By default column is bound to field named after it (see dashToCamel). That
+// can be changed with `db` struct tag, which takes column name followed by
+// comma separated options:
+//
+//	UserID  int64  `db:"user_id,pk"`
+//	Created string `db:",readonly"`
+//	Secret  string `db:"-"`
+//
+// Available options are:
+//
+//	pk         field is primary key, no matter what table info says
+//	readonly   column is never written, its value is computed by database
+//	omitempty  zero value is not inserted, so that column default is used
+//	created    field is set to current time when row is inserted, unless
+//	           it is set already, and is never updated
+//	updated    field is set to current time whenever row is written
+//	version    integer field is a version number used for optimistic
+//	           locking, it is incremented with every update and must match
+//	           the one in database (see ErrStaleObject), the option is
+//	           ignored for fields of other types
+//
+// Fields of time.Time or *time.Time type bound to created_at and updated_at
+// columns are treated as tagged with created and updated respectively. Time
+// is taken from session clock (see Session.WithClock). Integer field bound
+// to version column is treated as tagged with version.
+//
+// Field tagged with "-" and relation fields (see relation) are never mapped.
+// Fields of embedded structs are mapped as if they were fields of the outer
+// struct. Struct embedding Tracked remembers values of loaded rows (see
+// Tracked).
+type structmap struct {
+	table  *tableinfo
+	fields []*fieldmap
+	// columns of primary key and fields mapping them, if there are any
+	key []*tablefield
+	pk  []*fieldmap
+	// index of embedded Tracked, nil if struct is not tracked
+	tracked []int
+}
+
+type fieldmap struct {
+	column    *tablefield
+	index     []int
+	pk        bool
+	readonly  bool
+	omitempty bool
+	// field holds time the row was created or last updated
+	createstamp bool
+	updatestamp bool
+	version     bool
+}
+
+type structfield struct {
+	index       []int
+	name        string
+	column      string
+	pk          bool
+	readonly    bool
+	omitempty   bool
+	createstamp bool
+	updatestamp bool
+	version     bool
+}
+
+type structmapKey struct {
+	table *tableinfo
+	tp    reflect.Type
+}
+
+// mappings are computed once for every struct type and table pair. Dialects
+// cache table info, so the same *tableinfo is used for given table.
+var structmaps = struct {
+	lock sync.RWMutex
+	m    map[structmapKey]*structmap
+}{
+	m: make(map[structmapKey]*structmap),
+}
+
+// structmapFor returns cached mapping of given struct type onto table.
+func structmapFor(table *tableinfo, tp reflect.Type) *structmap {
+	key := structmapKey{table: table, tp: tp}
+	structmaps.lock.RLock()
+	sm, ok := structmaps.m[key]
+	structmaps.lock.RUnlock()
+	if ok {
+		return sm
+	}
+
+	structmaps.lock.Lock()
+	defer structmaps.lock.Unlock()
+	if sm, ok := structmaps.m[key]; ok {
+		return sm
+	}
+	sm = newStructmap(table, tp)
+	structmaps.m[key] = sm
+	return sm
+}
+
+func newStructmap(table *tableinfo, tp reflect.Type) *structmap {
+	explicit, implicit := indexFields(tp)
+	sm := &structmap{
+		table:  table,
+		fields: make([]*fieldmap, 0, len(table.fields)),
+	}
+	if sf, ok := tp.FieldByName("Tracked"); ok && sf.Anonymous && sf.Type == trackedType {
+		sm.tracked = sf.Index
+	}
+	for _, column := range table.fields {
+		f, ok := explicit[column.dbname]
+		if !ok {
+			f, ok = implicit[column.name]
+		}
+		if !ok {
+			continue
+		}
+		fm := &fieldmap{
+			column:      column,
+			index:       f.index,
+			pk:          f.pk,
+			readonly:    f.readonly,
+			omitempty:   f.omitempty,
+			createstamp: f.createstamp,
+			updatestamp: f.updatestamp,
+			version:     f.version,
+		}
+		if ftp := tp.FieldByIndex(f.index).Type; ftp == timeType || ftp == reflect.PtrTo(timeType) {
+			fm.createstamp = fm.createstamp || column.dbname == "created_at"
+			fm.updatestamp = fm.updatestamp || column.dbname == "updated_at"
+		}
+		switch tp.FieldByIndex(f.index).Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			fm.version = fm.version || column.dbname == "version"
+		default:
+			// version number must be an integer
+			fm.version = false
+		}
+		if f.pk {
+			sm.key = append(sm.key, column)
+			sm.pk = append(sm.pk, fm)
+		}
+		sm.fields = append(sm.fields, fm)
+	}
+
+	// struct does not override primary key, so use the one table has
+	if len(sm.pk) == 0 {
+		sm.key = table.pkfields
+		for _, column := range table.pkfields {
+			for _, fm := range sm.fields {
+				if fm.column == column {
+					fm.pk = true
+					sm.pk = append(sm.pk, fm)
+				}
+			}
+		}
+	}
+	return sm
+}
+
+// indexFields returns fields of given struct type by column name they are
+// tagged with and by field name.
+func indexFields(tp reflect.Type) (explicit, implicit map[string]*structfield) {
+	explicit = make(map[string]*structfield)
+	implicit = make(map[string]*structfield)
+	for _, f := range structFields(tp, nil) {
+		if f.column != "" {
+			if _, ok := explicit[f.column]; !ok {
+				explicit[f.column] = f
+			}
+		} else if _, ok := implicit[f.name]; !ok {
+			implicit[f.name] = f
+		}
+	}
+	return explicit, implicit
+}
+
+// resultFields returns indexes of fields of given struct type that result
+// columns of given names are bound to.
+func resultFields(tp reflect.Type, columns []string) ([][]int, error) {
+	explicit, implicit := indexFields(tp)
+	indexes := make([][]int, len(columns))
+	for i, column := range columns {
+		f, ok := explicit[column]
+		if !ok {
+			f, ok = implicit[dashToCamel(column)]
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s has no field for column %s", ErrInvalidItem, tp, column)
+		}
+		indexes[i] = f.index
+	}
+	return indexes, nil
+}
+
+// filter returns mapping of fields for which keep returns true
+func (sm *structmap) filter(keep func(*fieldmap) bool) *structmap {
+	filtered := &structmap{table: sm.table, tracked: sm.tracked}
+	for _, f := range sm.fields {
+		if !keep(f) {
+			continue
+		}
+		filtered.fields = append(filtered.fields, f)
+		if f.pk {
+			filtered.key = append(filtered.key, f.column)
+			filtered.pk = append(filtered.pk, f)
+		}
+	}
+	return filtered
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// stamp sets timestamp fields of given struct value to now, before the row
+// is inserted (if created is true) or updated.
+func (sm *structmap) stamp(structval reflect.Value, now time.Time, created bool) {
+	for _, field := range sm.fields {
+		if !field.updatestamp && !(created && field.createstamp) {
+			continue
+		}
+		f := structval.FieldByIndex(field.index)
+		if !field.updatestamp && !f.IsZero() {
+			// creation time was given explicitly
+			continue
+		}
+		if f.Kind() == reflect.Ptr {
+			t := now
+			f.Set(reflect.ValueOf(&t))
+		} else {
+			f.Set(reflect.ValueOf(now))
+		}
+	}
+}
+
+// versionField returns field holding version number of the row or nil
+func (sm *structmap) versionField() *fieldmap {
+	for _, field := range sm.fields {
+		if field.version {
+			return field
+		}
+	}
+	return nil
+}
+
+// versionOf returns version number held by given integer field
+func versionOf(f reflect.Value) int64 {
+	if f.CanUint() {
+		return int64(f.Uint())
+	}
+	return f.Int()
+}
+
+func setVersion(f reflect.Value, version int64) {
+	if f.CanUint() {
+		f.SetUint(uint64(version))
+	} else {
+		f.SetInt(version)
+	}
+}
+
+// writable returns columns written by INSERT (if created is true) or UPDATE
+// of given struct value, pointers to their values and, for INSERT, primary
+// key field that is not set and must be generated by database.
+func (sm *structmap) writable(structval reflect.Value, created bool) ([]string, []interface{}, *fieldmap) {
+	var generated *fieldmap
+	columns := make([]string, 0, len(sm.fields))
+	args := make([]interface{}, 0, len(sm.fields))
+	for _, field := range sm.fields {
+		if field.readonly {
+			continue
+		}
+		f := structval.FieldByIndex(field.index)
+		if field.pk {
+			// key is part of WHERE clause of update and is inserted only if
+			// it is set, otherwise database generates it
+			if !created {
+				continue
+			}
+			if f.IsZero() {
+				// parts of composite key are never generated
+				if len(sm.key) == 1 {
+					generated = field
+				}
+				continue
+			}
+		} else if created && field.omitempty && f.IsZero() {
+			continue
+		} else if !created && field.createstamp {
+			continue
+		}
+		columns = append(columns, field.column.dbname)
+		args = append(args, f.Addr().Interface())
+	}
+	return columns, args, generated
+}
+
+// keyvalues returns primary key columns and values of given struct value.
+// Error is returned if any part of the key is not mapped or is not set.
+func (sm *structmap) keyvalues(structval reflect.Value) ([]string, []interface{}, error) {
+	if len(sm.key) == 0 {
+		return nil, nil, fmt.Errorf("%w: table %s has no primary key", ErrIncompleteKey, sm.table.name)
+	}
+	columns := make([]string, len(sm.key))
+	values := make([]interface{}, len(sm.key))
+	for i, column := range sm.key {
+		columns[i] = column.dbname
+		f := sm.field(column)
+		if f == nil {
+			return nil, nil, fmt.Errorf("%w: %s is not mapped", ErrIncompleteKey, column.dbname)
+		}
+		val := structval.FieldByIndex(f.index)
+		if val.IsZero() {
+			return nil, nil, fmt.Errorf("%w: %s is not set", ErrIncompleteKey, column.dbname)
+		}
+		values[i] = val.Interface()
+	}
+	return columns, values, nil
+}
+
+// keyset tells if any part of primary key of given struct value is set
+func (sm *structmap) keyset(structval reflect.Value) bool {
+	for _, f := range sm.pk {
+		if !structval.FieldByIndex(f.index).IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// field returns mapping of given column or nil if struct does not map it
+func (sm *structmap) field(column *tablefield) *fieldmap {
+	for _, f := range sm.fields {
+		if f.column == column {
+			return f
+		}
+	}
+	return nil
+}
+
+// structFields returns all exported fields of given struct type that can be
+// bound to a column, including fields of embedded structs.
+func structFields(tp reflect.Type, index []int) []*structfield {
+	fields := make([]*structfield, 0, tp.NumField())
+	var embedded []*structfield
+	for i := 0; i < tp.NumField(); i++ {
+		sf := tp.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("db")
+		if tag == "-" || sf.Tag.Get("rel") != "" {
+			continue
+		}
+		f := &structfield{
+			index: append(append(make([]int, 0, len(index)+1), index...), i),
+			name:  sf.Name,
+		}
+		opts := strings.Split(tag, ",")
+		f.column = opts[0]
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "pk":
+				f.pk = true
+			case "readonly":
+				f.readonly = true
+			case "omitempty":
+				f.omitempty = true
+			case "created":
+				f.createstamp = true
+			case "updated":
+				f.updatestamp = true
+			case "version":
+				f.version = true
+			}
+		}
+		if sf.Anonymous && f.column == "" && sf.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, structFields(sf.Type, f.index)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	// fields of the outer struct take precedence over embedded ones
+	return append(fields, embedded...)
+}
+
+// values returns pointers to mapped fields of given struct value, in the same
+// order as columns are listed in table info.
+func (sm *structmap) values(structval reflect.Value) []interface{} {
+	return sm.scanargs(structval, make([]interface{}, len(sm.fields)))
+}
+
+// scanargs fills args with pointers to mapped fields of given struct value.
+// It allows to reuse the same slice when scanning multiple rows.
+func (sm *structmap) scanargs(structval reflect.Value, args []interface{}) []interface{} {
+	for i, f := range sm.fields {
+		args[i] = structval.FieldByIndex(f.index).Addr().Interface()
+	}
+	return args
+}
+
+func (sm *structmap) columns() []string {
+	columns := make([]string, len(sm.fields))
+	for i, f := range sm.fields {
+		columns[i] = f.column.dbname
+	}
+	return columns
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStructmap(t *testing.T) {
+	table := &tableinfo{
+		name: "posts",
+		fields: []*tablefield{
+			{name: "Id", dbname: "id", pk: true},
+			{name: "UserId", dbname: "user_id"},
+			{name: "Title", dbname: "title"},
+			{name: "CreatedAt", dbname: "created_at"},
+		},
+	}
+	table.pkfields = table.fields[:1]
+
+	type Timestamps struct {
+		CreatedAt string `db:",readonly"`
+	}
+	type Post struct {
+		Timestamps
+		ID     int64  `db:"id"`
+		UserID int64  `db:"user_id"`
+		Title  string `db:",omitempty"`
+		UserId int64  `db:"-"`
+	}
+
+	sm := newStructmap(table, reflect.TypeOf(Post{}))
+	expected := []string{"id", "user_id", "title", "created_at"}
+	if columns := sm.columns(); !reflect.DeepEqual(columns, expected) {
+		t.Fatalf("expected columns %v, got %v", expected, columns)
+	}
+	if len(sm.pk) != 1 || sm.pk[0].column.dbname != "id" {
+		t.Fatalf("invalid primary key: %#v", sm.pk)
+	}
+	if !sm.fields[2].omitempty || !sm.fields[3].readonly {
+		t.Fatalf("tag options not parsed: %#v %#v", sm.fields[2], sm.fields[3])
+	}
+
+	post := &Post{ID: 1, UserID: 2, Title: "hello", UserId: 3}
+	post.CreatedAt = "yesterday"
+	values := sm.values(reflect.ValueOf(post).Elem())
+	if *values[0].(*int64) != 1 || *values[1].(*int64) != 2 ||
+		*values[2].(*string) != "hello" || *values[3].(*string) != "yesterday" {
+		t.Fatal("values do not point to mapped fields")
+	}
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"reflect"
+)
+
+// Items can implement any of following interfaces to run code whenever they
+// are saved, deleted or loaded. Hooks are called with the session that runs
+// the statement, so they can run other statements within the same
+// transaction. Error returned by Before hook aborts the statement, error
+// returned by After hook is returned to the caller.
+//
+// Save, Update, InsertAll and Upsert call BeforeSave and AfterSave, Delete
+// calls BeforeDelete and AfterDelete. AfterLoad is called for every item
+// fetched by query, once its relations are preloaded. Set-based Query.Update
+// and Query.Delete do not call any hooks.
+type BeforeSaver interface {
+	BeforeSave(s *Session) error
+}
+
+type AfterSaver interface {
+	AfterSave(s *Session) error
+}
+
+type BeforeDeleter interface {
+	BeforeDelete(s *Session) error
+}
+
+type AfterDeleter interface {
+	AfterDelete(s *Session) error
+}
+
+type AfterLoader interface {
+	AfterLoad(s *Session) error
+}
+
+// hookable returns item that hook interfaces should be tested on. Hooks are
+// usually implemented by pointer receivers.
+func hookable(structval reflect.Value) interface{} {
+	if structval.CanAddr() {
+		return structval.Addr().Interface()
+	}
+	return structval.Interface()
+}
+
+func beforeSave(s *Session, structval reflect.Value) error {
+	if h, ok := hookable(structval).(BeforeSaver); ok {
+		return h.BeforeSave(s)
+	}
+	return nil
+}
+
+func afterSave(s *Session, structval reflect.Value) error {
+	if h, ok := hookable(structval).(AfterSaver); ok {
+		return h.AfterSave(s)
+	}
+	return nil
+}
+
+func beforeDelete(s *Session, structval reflect.Value) error {
+	if h, ok := hookable(structval).(BeforeDeleter); ok {
+		return h.BeforeDelete(s)
+	}
+	return nil
+}
+
+func afterDelete(s *Session, structval reflect.Value) error {
+	if h, ok := hookable(structval).(AfterDeleter); ok {
+		return h.AfterDelete(s)
+	}
+	return nil
+}
+
+func afterLoad(s *Session, structval reflect.Value) error {
+	if h, ok := hookable(structval).(AfterLoader); ok {
+		return h.AfterLoad(s)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var errNoName = errors.New("name is required")
+
+type HookedUser struct {
+	Id   int64
+	Name string
+
+	saved   int
+	deleted int
+	Loaded  bool `db:"-"`
+}
+
+func (u *HookedUser) BeforeSave(s *Session) error {
+	if u.Name == "" {
+		return errNoName
+	}
+	u.Name = strings.ToLower(u.Name)
+	return nil
+}
+
+func (u *HookedUser) AfterSave(s *Session) error {
+	u.saved++
+	return nil
+}
+
+func (u *HookedUser) BeforeDelete(s *Session) error {
+	if u.Name == "bob" {
+		return ErrInvalidItem
+	}
+	return nil
+}
+
+func (u *HookedUser) AfterDelete(s *Session) error {
+	u.deleted++
+	return nil
+}
+
+func (u *HookedUser) AfterLoad(s *Session) error {
+	u.Loaded = true
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		users := session.Table("users")
+
+		user := &HookedUser{Name: "JIM"}
+		if _, err := users.Save(user); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		if user.Name != "jim" || user.saved != 1 {
+			t.Fatalf("save hooks were not called: %#v", user)
+		}
+		if _, err := users.Save(&HookedUser{}); err != errNoName {
+			t.Fatalf("expected save to be aborted, got %v", err)
+		}
+		if count, _ := users.Query().Count(); count != 4 {
+			t.Fatalf("expected 4 users, got %d", count)
+		}
+
+		batch := []*HookedUser{{Name: "ANN"}, {Name: "TOM"}}
+		if err := users.InsertAll(batch); err != nil {
+			t.Fatalf("cannot insert users: %s", err)
+		}
+		if batch[0].Name != "ann" || batch[1].saved != 1 {
+			t.Fatalf("save hooks were not called: %#v", batch)
+		}
+
+		loaded := &HookedUser{}
+		if err := users.Get(loaded, user.Id); err != nil {
+			t.Fatalf("cannot get user: %s", err)
+		}
+		if !loaded.Loaded || loaded.Name != "jim" {
+			t.Fatalf("load hook was not called: %#v", loaded)
+		}
+		all := make([]HookedUser, 0)
+		if err := users.Query().All(&all); err != nil {
+			t.Fatalf("cannot query users: %s", err)
+		}
+		for _, u := range all {
+			if !u.Loaded {
+				t.Fatalf("load hook was not called: %#v", u)
+			}
+		}
+
+		if err := users.Delete(loaded); err != nil {
+			t.Fatalf("cannot delete user: %s", err)
+		}
+		if loaded.deleted != 1 {
+			t.Fatal("delete hook was not called")
+		}
+		bob := &HookedUser{Id: 1, Name: "bob"}
+		if err := users.Delete(bob); err != ErrInvalidItem {
+			t.Fatalf("expected delete to be aborted, got %v", err)
+		}
+		if exists, _ := users.Query().Where("id =", 1).Exists(); !exists {
+			t.Fatal("aborted delete should not remove the row")
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Iter is a cursor over rows fetched by the query, which are scanned one by
+// one, instead of all at once like All does:
+//
+//	user := &User{}
+//	it := session.Table("users").Query().Iter(user)
+//	defer it.Close()
+//	for it.Next() {
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Iter must be closed if iteration is interrupted, otherwise it is closed
+// once all rows are read.
+type Iter struct {
+	q    *Query
+	rows *sql.Rows
+	jm   *joinmap
+	args []interface{}
+	dest reflect.Value
+	err  error
+}
+
+// Iter returns cursor over matching rows, which scans every row into dest
+// (pointer to struct). Preload cannot be used with it.
+func (q *Query) Iter(dest interface{}) *Iter {
+	it := &Iter{q: q}
+	structval := reflect.ValueOf(dest)
+	for structval.Kind() == reflect.Ptr {
+		structval = structval.Elem()
+	}
+	if structval.Kind() != reflect.Struct || !structval.CanSet() {
+		it.err = ErrInvalidItem
+		return it
+	}
+	it.dest = structval
+	it.open(structval.Type())
+	return it
+}
+
+func (it *Iter) open(tp reflect.Type) {
+	if len(it.q.preloads) != 0 {
+		// related rows can be loaded only once all rows are fetched
+		it.err = fmt.Errorf("%w: cannot preload while iterating", ErrInvalidRelation)
+		return
+	}
+	it.rows, it.jm, it.err = it.q.open(tp)
+	if it.err == nil {
+		it.args = make([]interface{}, it.jm.columns)
+	}
+}
+
+// Next scans next row into destination. It returns false when there are no
+// more rows or an error occurred.
+func (it *Iter) Next() bool {
+	return it.next(it.dest)
+}
+
+func (it *Iter) next(structval reflect.Value) bool {
+	if it.rows == nil {
+		return false
+	}
+	if !it.rows.Next() {
+		it.err = it.q.rowsErr(it.rows)
+		it.Close()
+		return false
+	}
+	// fields not fetched by the query must not keep values of previous row
+	structval.Set(reflect.Zero(structval.Type()))
+	if err := it.rows.Scan(it.jm.scanargs(structval, it.args)...); err != nil {
+		it.q.mapping.session.log.Error("cannot scan result row: %s", err)
+		it.err = err
+		it.Close()
+		return false
+	}
+	it.jm.assign(structval, it.args)
+	it.jm.remember(structval)
+	if err := afterLoad(it.q.mapping.session, structval); err != nil {
+		it.err = err
+		it.Close()
+		return false
+	}
+	return true
+}
+
+// Err returns error that interrupted iteration, if any.
+func (it *Iter) Err() error {
+	return it.err
+}
+
+// Close releases rows of the cursor. It is safe to call it multiple times.
+func (it *Iter) Close() error {
+	if it.rows == nil {
+		return nil
+	}
+	err := it.rows.Close()
+	it.rows = nil
+	return err
+}
+
+// Each calls fn for every matching row, as soon as it is fetched. fn must be
+// a function taking pointer to struct, which row is scanned into, and
+// returning error. Iteration stops at the first error returned by fn, which
+// is then returned by Each. Preload cannot be used with it.
+//
+//	err := q.Each(func(user *User) error {
+//		...
+//	})
+func (q *Query) Each(fn interface{}) error {
+	fnval := reflect.ValueOf(fn)
+	if !fnval.IsValid() {
+		q.mapping.session.log.Error("query Each() callback is nil")
+		return ErrInvalidItem
+	}
+	fntp := fnval.Type()
+	if fntp.Kind() != reflect.Func || fntp.NumIn() != 1 || fntp.NumOut() != 1 ||
+		fntp.In(0).Kind() != reflect.Ptr || fntp.In(0).Elem().Kind() != reflect.Struct ||
+		fntp.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
+		q.mapping.session.log.Error("query Each() callback is not func(*T) error (got %s)", fntp)
+		return ErrInvalidItem
+	}
+	tp := fntp.In(0).Elem()
+
+	it := &Iter{q: q}
+	it.open(tp)
+	defer it.Close()
+	for {
+		item := reflect.New(tp)
+		if !it.next(item.Elem()) {
+			return it.Err()
+		}
+		if err := fnval.Call([]reflect.Value{item})[0]; !err.IsNil() {
+			return err.Interface().(error)
+		}
+	}
+}
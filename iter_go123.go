@@ -0,0 +1,35 @@
+//go:build go1.23
+
+package db
+
+import (
+	"iter"
+)
+
+// Seq returns iterator over rows matching the query, scanned into values of
+// struct type T one by one:
+//
+//	for user, err := range db.Seq[User](q) {
+//		if err != nil {
+//			...
+//		}
+//	}
+//
+// Rows are released as soon as loop is finished or interrupted. Error is
+// yielded at most once, as the last element.
+func Seq[T any](q *Query) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var item T
+		it := q.Iter(&item)
+		defer it.Close()
+		for it.Next() {
+			if !yield(item, nil) {
+				return
+			}
+		}
+		if err := it.Err(); err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
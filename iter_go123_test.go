@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestQuerySeq(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := UseAutocommit(db, Sqlite3Dialect)
+
+		names := make([]string, 0)
+		for user, err := range Seq[User](session.Table("users").Query().OrderBy("id")) {
+			if err != nil {
+				t.Fatalf("cannot iterate over users: %s", err)
+			}
+			names = append(names, user.Name)
+			if len(names) == 2 {
+				break
+			}
+		}
+		if len(names) != 2 || names[0] != "bob" || names[1] != "mike" {
+			t.Fatalf("unexpected users: %v", names)
+		}
+		if inUse := db.Stats().InUse; inUse != 0 {
+			t.Fatalf("rows should be closed after break, %d connections in use", inUse)
+		}
+
+		var err error
+		for _, err = range Seq[User](session.Table("users").Query().Where(42)) {
+		}
+		if !errors.Is(err, ErrInvalidCondition) {
+			t.Fatalf("expected invalid condition error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestQueryIter(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := UseAutocommit(db, Sqlite3Dialect)
+
+		user := &User{}
+		it := session.Table("users").Query().OrderBy("id").Iter(user)
+		ids := make([]int64, 0)
+		for it.Next() {
+			if user.Name == "" {
+				t.Fatalf("not all fields were fetched: %#v", user)
+			}
+			ids = append(ids, user.Id)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("cannot iterate over users: %s", err)
+		}
+		if len(ids) != 3 || ids[0] != 1 || ids[2] != 3 {
+			t.Fatalf("unexpected users: %v", ids)
+		}
+		if inUse := db.Stats().InUse; inUse != 0 {
+			t.Fatalf("rows should be closed after iteration, %d connections in use", inUse)
+		}
+
+		// early termination
+		it = session.Table("users").Query().Iter(user)
+		if !it.Next() {
+			t.Fatalf("expected a row: %v", it.Err())
+		}
+		it.Close()
+		if it.Next() {
+			t.Fatal("closed iterator should not return rows")
+		}
+		if inUse := db.Stats().InUse; inUse != 0 {
+			t.Fatalf("rows should be closed, %d connections in use", inUse)
+		}
+
+		it = session.Table("users").Query().Preload("Posts").Iter(&Author{})
+		if it.Next() || !errors.Is(it.Err(), ErrInvalidRelation) {
+			t.Fatalf("expected invalid relation error, got %v", it.Err())
+		}
+	})
+}
+
+func TestQueryEach(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := UseAutocommit(db, Sqlite3Dialect)
+
+		users := make([]*User, 0)
+		err := session.Table("users").Query().OrderBy("id").Each(func(user *User) error {
+			users = append(users, user)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("cannot iterate over users: %s", err)
+		}
+		if len(users) != 3 || users[0].Name != "bob" || users[1].Name != "mike" {
+			t.Fatalf("unexpected users: %#v", users)
+		}
+
+		stop := errors.New("stop")
+		count := 0
+		err = session.Table("users").Query().Each(func(user *User) error {
+			count++
+			return stop
+		})
+		if err != stop || count != 1 {
+			t.Fatalf("expected iteration to stop after first row, got %v after %d rows", err, count)
+		}
+		if inUse := db.Stats().InUse; inUse != 0 {
+			t.Fatalf("rows should be closed, %d connections in use", inUse)
+		}
+
+		if err := session.Table("users").Query().Each(func(user User) {}); err != ErrInvalidItem {
+			t.Fatalf("expected invalid item error, got %v", err)
+		}
+		if err := session.Table("users").Query().Each(nil); err != ErrInvalidItem {
+			t.Fatalf("expected invalid item error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+)
+
+type join struct {
+	kind  string
+	table string
+	on    string
+}
+
+// Join adds table to the query with INNER JOIN on given condition, for
+// example:
+//
+//	Join("teams", "teams.id = users.team_id")
+//
+// Once query has joins, selected columns are qualified with table name, but
+// conditions and order are written as given, so ambiguous column names must
+// be qualified by the caller.
+//
+// Columns of joined table are scanned into field of destination struct that
+// holds a struct (or pointer to it) and is tagged with table name or named
+// after it, in plural or singular form:
+//
+//	type UserTeam struct {
+//		User
+//		Team Team
+//	}
+//
+// Columns of the queried table are scanned the same way if such field exists,
+// otherwise they are mapped onto the destination struct itself.
+func (q *Query) Join(table, on string) *Query {
+	q.joins = append(q.joins, join{kind: "JOIN", table: table, on: on})
+	return q
+}
+
+// LeftJoin works like Join, but uses LEFT JOIN. Field pointing to struct is
+// left nil if there is no matching row.
+func (q *Query) LeftJoin(table, on string) *Query {
+	q.joins = append(q.joins, join{kind: "LEFT JOIN", table: table, on: on})
+	return q
+}
+
+// joinmap describes how row fetched by the query is scanned into destination
+// struct: it is made of columns of every table of the query, in order.
+type joinmap struct {
+	parts   []*joinpart
+	columns int
+}
+
+type joinpart struct {
+	fields *structmap
+	// index of the field holding the struct, nil for destination itself
+	index []int
+	ptr   bool
+}
+
+func (q *Query) joinmap(tp reflect.Type) (*joinmap, error) {
+	table, err := q.mapping.tableinfo()
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]*joinpart, 0, len(q.joins)+1)
+	if len(q.joins) == 0 {
+		parts = append(parts, &joinpart{fields: structmapFor(table, tp)})
+	} else {
+		main := q.joinpart(table, tp)
+		parts = append(parts, main)
+		targets := make(map[int]bool, len(q.joins))
+		for _, j := range q.joins {
+			joined, err := q.mapping.session.Table(j.table).tableinfo()
+			if err != nil {
+				return nil, err
+			}
+			part := q.joinpart(joined, tp)
+			if part.index == nil {
+				q.mapping.session.log.Error("query destination has no field for table %s", j.table)
+				return nil, ErrInvalidItem
+			}
+			targets[part.index[0]] = true
+			parts = append(parts, part)
+		}
+		if main.index == nil {
+			// fields of joined structs must not be mapped onto queried table
+			main.fields = main.fields.filter(func(f *fieldmap) bool {
+				return !targets[f.index[0]]
+			})
+		}
+	}
+
+	if len(q.selects) != 0 {
+		if err := q.project(parts); err != nil {
+			return nil, err
+		}
+	}
+	jm := &joinmap{parts: parts}
+	for _, part := range parts {
+		jm.columns += len(part.fields.fields)
+	}
+	return jm, nil
+}
+
+// joinpart returns mapping of given table onto struct field dedicated to it
+// or, if there is none, onto struct itself.
+func (q *Query) joinpart(table *tableinfo, tp reflect.Type) *joinpart {
+	singular := strings.TrimSuffix(table.name, "s")
+	for i := 0; i < tp.NumField(); i++ {
+		sf := tp.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous || sf.Tag.Get("rel") != "" {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("db"), ",")[0]
+		if name != table.name && (name != "" ||
+			sf.Name != dashToCamel(table.name) && sf.Name != dashToCamel(singular)) {
+			continue
+		}
+		ftp := sf.Type
+		ptr := ftp.Kind() == reflect.Ptr
+		if ptr {
+			ftp = ftp.Elem()
+		}
+		if ftp.Kind() != reflect.Struct {
+			continue
+		}
+		return &joinpart{fields: structmapFor(table, ftp), index: sf.Index, ptr: ptr}
+	}
+	return &joinpart{fields: structmapFor(table, tp)}
+}
+
+// scanargs fills args with scan destinations for all columns of the row.
+// Columns of structs stored by pointer are scanned into pointers to values,
+// so that NULLs of missing rows can be told apart, and must be assigned to
+// the struct with assign afterwards.
+func (jm *joinmap) scanargs(structval reflect.Value, args []interface{}) []interface{} {
+	offset := 0
+	for _, part := range jm.parts {
+		n := len(part.fields.fields)
+		switch {
+		case part.index == nil:
+			part.fields.scanargs(structval, args[offset:offset+n])
+		case !part.ptr:
+			part.fields.scanargs(structval.FieldByIndex(part.index), args[offset:offset+n])
+		default:
+			elem := structval.FieldByIndex(part.index).Type().Elem()
+			for i, f := range part.fields.fields {
+				args[offset+i] = reflect.New(reflect.PtrTo(elem.FieldByIndex(f.index).Type)).Interface()
+			}
+		}
+		offset += n
+	}
+	return args
+}
+
+// assign stores values of columns scanned by pointers into their structs.
+// Struct is left nil if all of its columns are NULL.
+func (jm *joinmap) assign(structval reflect.Value, args []interface{}) {
+	offset := 0
+	for _, part := range jm.parts {
+		n := len(part.fields.fields)
+		if part.ptr {
+			field := structval.FieldByIndex(part.index)
+			item := reflect.Value{}
+			for i, f := range part.fields.fields {
+				val := reflect.ValueOf(args[offset+i]).Elem()
+				if val.IsNil() {
+					continue
+				}
+				if !item.IsValid() {
+					item = reflect.New(field.Type().Elem())
+				}
+				item.Elem().FieldByIndex(f.index).Set(val.Elem())
+			}
+			if item.IsValid() {
+				field.Set(item)
+			} else {
+				field.Set(reflect.Zero(field.Type()))
+			}
+		}
+		offset += n
+	}
+}
+
+// selectFrom writes SELECT clause of all mapped columns and FROM clause with
+// all joined tables.
+func (jm *joinmap) selectFrom(b *sqlbuilder, table string, joins []join, distinct bool) {
+	if len(joins) == 0 && !distinct {
+		b.selectFrom(table, jm.parts[0].fields.columns())
+		return
+	}
+	b.write("SELECT ")
+	if distinct {
+		b.write("DISTINCT ")
+	}
+	for i, part := range jm.parts {
+		for j, column := range part.fields.columns() {
+			if i != 0 || j != 0 {
+				b.write(", ")
+			}
+			if len(joins) == 0 {
+				b.ident(column)
+			} else {
+				b.qualified(part.fields.table.name, column)
+			}
+		}
+	}
+	b.write(" FROM ").ident(table)
+	b.joins(joins)
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+)
+
+type PostWithUser struct {
+	Post
+	User User
+}
+
+type UserWithPost struct {
+	User
+	Post *Post
+}
+
+func TestQueryJoin(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		posts := make([]PostWithUser, 0)
+		q := session.Table("posts").Query().
+			Join("users", "users.id = posts.user_id").
+			Where("users.name =", "bob").
+			OrderBy("posts.id")
+		if err := q.All(&posts); err != nil {
+			t.Fatalf("cannot query posts: %s", err)
+		}
+		if len(posts) != 2 {
+			t.Fatalf("expected 2 posts, got %d", len(posts))
+		}
+		for _, post := range posts {
+			if post.Title == "" || post.User.Id != 1 || post.User.Name != "bob" {
+				t.Fatalf("invalid joined row: %#v", post)
+			}
+		}
+		if posts[0].Id != 1 || posts[1].Id != 2 {
+			t.Fatalf("posts are not ordered: %d, %d", posts[0].Id, posts[1].Id)
+		}
+		if count, err := q.Count(); err != nil || count != 2 {
+			t.Fatalf("expected count of 2, got %d (%v)", count, err)
+		}
+
+		users := make([]*UserWithPost, 0)
+		q = session.Table("users").Query().
+			LeftJoin("posts", "posts.user_id = users.id").
+			OrderBy("users.id", "posts.id")
+		if err := q.All(&users); err != nil {
+			t.Fatalf("cannot query users: %s", err)
+		}
+		if len(users) != 4 {
+			t.Fatalf("expected 4 rows, got %d", len(users))
+		}
+		titles := []string{"first", "second", "third", ""}
+		for i, user := range users {
+			if user.Id == 0 || user.Name == "" {
+				t.Fatalf("user not fetched: %#v", user)
+			}
+			if titles[i] == "" {
+				if user.Post != nil {
+					t.Fatalf("%s should have no post, got %#v", user.Name, user.Post)
+				}
+			} else if user.Post == nil || user.Post.Title != titles[i] || user.Post.UserId != user.Id {
+				t.Fatalf("expected %s post %q, got %#v", user.Name, titles[i], user.Post)
+			}
+		}
+
+		user := &UserWithPost{}
+		q = session.Table("users").Query().
+			LeftJoin("posts", "posts.user_id = users.id").
+			Where("users.name =", "mike")
+		if err := q.One(user); err != nil {
+			t.Fatalf("cannot query user: %s", err)
+		}
+		if user.Name != "mike" || user.Post == nil || user.Post.Title != "third" {
+			t.Fatalf("invalid joined row: %#v", user)
+		}
+
+		err := session.Table("users").Query().Join("tags", "1 = 1").All(&users)
+		if err != ErrInvalidItem {
+			t.Fatalf("expected invalid item error for unmapped join, got %v", err)
+		}
+	})
+}
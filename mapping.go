@@ -1,23 +1,25 @@
 package db
 
 import (
+	"fmt"
 	"reflect"
-	"strings"
+	"time"
 )
 
 type TableMapping struct {
 	name    string
 	session *Session
+	// column marking deleted rows, if set with SoftDelete
+	softdelete *string
 }
 
 func (m *TableMapping) Query() *Query {
 	return &Query{
-		mapping:    m,
-		filtercond: make([]string, 0, 2),
-		filtervals: make([]interface{}, 0, 2),
-		limit:      -1,
-		offset:     -1,
-		order:      order{asc: make([]string, 0, 1), desc: make([]string, 0, 1)},
+		mapping: m,
+		filter:  make([]Cond, 0, 2),
+		limit:   -1,
+		offset:  -1,
+		order:   order{asc: make([]string, 0, 1), desc: make([]string, 0, 1)},
 	}
 }
 
@@ -33,74 +35,475 @@ func (m *TableMapping) Save(item interface{}) (created bool, err error) {
 	if val.Type().Kind() != reflect.Struct {
 		return false, ErrInvalidItem
 	}
-	var pkfield reflect.Value
-	fieldNames := make([]string, 0, len(table.fields))
-	args := make([]interface{}, 0, len(table.fields))
+	if err := beforeSave(m.session, val); err != nil {
+		return false, err
+	}
+	created, err = m.save(table, val)
+	if err != nil {
+		return created, err
+	}
+	return created, afterSave(m.session, val)
+}
 
-	for _, field := range table.fields {
-		f := val.FieldByName(field.name)
-		if f.IsValid() {
-			if field.pk {
-				pkfield = f
-				continue
-			}
-			fieldNames = append(fieldNames, field.dbname)
-			args = append(args, f.Addr().Interface())
+func (m *TableMapping) save(table *tableinfo, val reflect.Value) (created bool, err error) {
+	dialect := m.session.dialect
+	fields := structmapFor(table, val.Type())
+
+	// item is created if its primary key is not set (so that it is generated
+	// by database), otherwise existing row is updated. Row with composite key
+	// can be inserted with all parts of the key set, so check if it exists.
+	keycols, keyvals, keyerr := fields.keyvalues(val)
+	created = keyerr != nil
+	if created && len(fields.key) > 1 && fields.keyset(val) {
+		// only some parts of composite key are set
+		return false, keyerr
+	}
+	if !created && len(fields.key) > 1 {
+		exists, err := m.exists(keycols, keyvals)
+		if err != nil {
+			return false, err
+		}
+		created = !exists
+	}
+
+	if !created {
+		// tracked item updates only columns changed since it was loaded
+		dirty, tracked := fields.dirty(val)
+		delete(dirty, m.deletedColumn(table))
+		if tracked && len(dirty) == 0 {
+			return created, nil
 		}
+		return created, m.update(table, fields, val, dirty, keycols, keyvals)
 	}
 
 	// XXX what if struct does not map table completly?
-	if pkfield.IsValid() && pkfield.Interface() != reflect.Zero(pkfield.Type()).Interface() {
-		created = false
-		sqlChunks := []string{`UPDATE "`, table.name, `" SET "`}
-		for i, name := range fieldNames {
-			if i == len(fieldNames)-1 {
-				sqlChunks = append(sqlChunks, name, `" = ?`)
-			} else {
-				sqlChunks = append(sqlChunks, name, `" = ?, "`)
-			}
+	fieldNames, args, generated := m.writable(fields, val, created)
+	defer func() {
+		if err == nil {
+			fields.remember(val, nil)
 		}
-		sqlChunks = append(sqlChunks, ` WHERE "`, table.pkfield.dbname, `" = ?`)
-		sql := strings.Join(sqlChunks, "")
-		// value for WHERE <primary key> = ?
-		args = append(args, pkfield.Addr().Interface())
-		_, err := m.session.Exec(sql, args...)
+	}()
+
+	var returning string
+	if generated != nil && dialect.Returning(generated.column.dbname) != "" {
+		returning = generated.column.dbname
+	}
+	sqlquery := newSQLBuilder(dialect).insert(table.name, fieldNames, args, returning)
+	if returning != "" {
+		rows, err := m.session.Query(sqlquery.String(), sqlquery.args...)
 		if err != nil {
 			return created, err
 		}
+		defer rows.Close()
+		if rows.Next() {
+			pkfield := val.FieldByIndex(generated.index)
+			if err := rows.Scan(pkfield.Addr().Interface()); err != nil {
+				return created, err
+			}
+		}
+		return created, m.session.canceled(m.session.context(), rows.Err())
+	}
+	res, err := m.session.Exec(sqlquery.String(), sqlquery.args...)
+	if err != nil {
+		return created, err
+	}
+	if generated != nil {
+		id, err := res.LastInsertId()
+		pkfield := val.FieldByIndex(generated.index)
+		// we cannot assume that the primary key is number, so just skip this one
+		if err == nil && pkfield.CanInt() {
+			pkfield.SetInt(id)
+		}
+	}
+	return created, nil
+}
+
+// update writes existing row of given struct value. If only is not nil,
+// just columns in it are written, along with timestamp and version.
+func (m *TableMapping) update(table *tableinfo, fields *structmap, val reflect.Value, only map[string]bool, keycols []string, keyvals []interface{}) error {
+	columns, args, _ := m.writable(fields, val, false)
+	if only != nil {
+		columns, args = fields.partial(columns, args, only)
+	}
+	if len(columns) == 0 {
+		// nothing but the key is mapped
+		return nil
+	}
+	if version := fields.versionField(); version != nil {
+		if err := m.updateVersioned(table, version, val, columns, args, keycols, keyvals); err != nil {
+			return err
+		}
 	} else {
-		created = true
-		sqlChunks := []string{`INSERT INTO `, table.name, `("`}
-		for i, name := range fieldNames {
-			if i == len(fieldNames)-1 {
-				sqlChunks = append(sqlChunks, name, `") VALUES(`)
-			} else {
-				sqlChunks = append(sqlChunks, name, `", "`)
+		sqlquery := newSQLBuilder(m.session.dialect).update(table.name, columns, args)
+		sqlquery.whereEq(keycols, keyvals)
+		if _, err := m.session.Exec(sqlquery.String(), sqlquery.args...); err != nil {
+			return err
+		}
+	}
+	fields.remember(val, columns)
+	return nil
+}
+
+// updateVersioned updates row only if its version matches the one of item,
+// incrementing it. ErrStaleObject is returned if there is no such row.
+func (m *TableMapping) updateVersioned(table *tableinfo, version *fieldmap, val reflect.Value, columns []string, args []interface{}, keycols []string, keyvals []interface{}) error {
+	f := val.FieldByIndex(version.index)
+	current := versionOf(f)
+	for i, column := range columns {
+		if column == version.column.dbname {
+			args[i] = current + 1
+		}
+	}
+	conds := append(eqConds(keycols, keyvals), Eq(version.column.dbname, current))
+	sqlquery := newSQLBuilder(m.session.dialect).update(table.name, columns, args).where(conds)
+	if err := m.execOne(sqlquery); err != nil {
+		if err == ErrNotFound {
+			return fmt.Errorf("%w: %s row of version %d", ErrStaleObject, table.name, current)
+		}
+		return err
+	}
+	setVersion(f, current+1)
+	return nil
+}
+
+// InsertAll inserts all items of given slice, which holds structures or
+// pointers to them, with multi-row INSERT statements. Each statement inserts
+// as many items as dialect limit of bind parameters allows (see
+// Dialect.MaxParams). Generated primary keys are stored in items only if
+// dialect supports RETURNING clause. Keys are assigned to items in order
+// rows are returned, relying on database to return them in order of VALUES
+// list, which PostgreSQL does in practice, but does not guarantee.
+func (m *TableMapping) InsertAll(items interface{}) error {
+	table, err := m.tableinfo()
+	if err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(items)
+	for slice.Kind() == reflect.Ptr {
+		slice = slice.Elem()
+	}
+	if slice.Kind() != reflect.Slice {
+		return ErrInvalidItem
+	}
+	itemTp := slice.Type().Elem()
+	if itemTp.Kind() == reflect.Ptr {
+		itemTp = itemTp.Elem()
+	}
+	if itemTp.Kind() != reflect.Struct {
+		return ErrInvalidItem
+	}
+	fields := structmapFor(table, itemTp)
+	maxParams := m.session.dialect.MaxParams()
+
+	// consecutive items writing the same columns are inserted together
+	var batch insertBatch
+	for i := 0; i < slice.Len(); i++ {
+		val := reflect.Indirect(slice.Index(i))
+		if !val.IsValid() {
+			return ErrInvalidItem
+		}
+		if err := beforeSave(m.session, val); err != nil {
+			return err
+		}
+		columns, args, generated := m.writable(fields, val, true)
+		if len(columns) == 0 {
+			return ErrInvalidItem
+		}
+		if !batch.fits(columns, generated, maxParams) {
+			if err := m.insertBatch(table, &batch); err != nil {
+				return err
 			}
+			batch = insertBatch{columns: columns, generated: generated}
+		}
+		batch.items = append(batch.items, val)
+		batch.args = append(batch.args, args...)
+	}
+	return m.insertBatch(table, &batch)
+}
+
+// insertBatch holds items inserted by single statement
+type insertBatch struct {
+	columns   []string
+	generated *fieldmap
+	items     []reflect.Value
+	args      []interface{}
+}
+
+// fits tells if item writing given columns can be added to the batch
+func (b *insertBatch) fits(columns []string, generated *fieldmap, maxParams int) bool {
+	if len(b.items) == 0 || b.generated != generated || len(b.columns) != len(columns) {
+		return false
+	}
+	if len(b.args)+len(columns) > maxParams {
+		return false
+	}
+	for i, column := range columns {
+		if b.columns[i] != column {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *TableMapping) insertBatch(table *tableinfo, batch *insertBatch) error {
+	if len(batch.items) == 0 {
+		return nil
+	}
+	dialect := m.session.dialect
+	var returning string
+	if batch.generated != nil && dialect.Returning(batch.generated.column.dbname) != "" {
+		returning = batch.generated.column.dbname
+	}
+	sqlquery := newSQLBuilder(dialect).insertRows(table.name, batch.columns, len(batch.items), batch.args)
+	sqlquery.returning(returning)
+	if returning == "" {
+		if _, err := m.session.Exec(sqlquery.String(), sqlquery.args...); err != nil {
+			return err
+		}
+	} else if n, err := m.insertReturning(sqlquery, batch); err != nil {
+		return err
+	} else if n != len(batch.items) {
+		return fmt.Errorf("%w: %d keys returned for %d inserted rows", ErrIncompleteKey, n, len(batch.items))
+	}
+	for _, item := range batch.items {
+		if err := afterSave(m.session, item); err != nil {
+			return err
 		}
-		for i := len(fieldNames); i > 0; i-- {
-			if i == 1 {
-				sqlChunks = append(sqlChunks, "?)")
-			} else {
-				sqlChunks = append(sqlChunks, "?, ")
+	}
+	return nil
+}
+
+// insertReturning runs INSERT statement of batch items and stores primary
+// keys it returns in them. Returns number of keys stored, which is lower than
+// number of items if fewer rows were returned.
+func (m *TableMapping) insertReturning(sqlquery *sqlbuilder, batch *insertBatch) (int, error) {
+	rows, err := m.session.Query(sqlquery.String(), sqlquery.args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	// rows are assumed to be returned in order they were inserted
+	n := 0
+	for _, item := range batch.items {
+		if !rows.Next() {
+			break
+		}
+		pkfield := item.FieldByIndex(batch.generated.index)
+		if err := rows.Scan(pkfield.Addr().Interface()); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, m.session.canceled(m.session.context(), rows.Err())
+}
+
+// Conflict tells what Upsert does when inserted row conflicts with existing
+// one.
+type Conflict struct {
+	// Columns of unique key checked for conflicts. MySQL ignores them and
+	// checks all unique keys of the table.
+	Columns []string
+	// Update lists columns of existing row set to inserted values. By
+	// default all inserted columns but conflict and primary key ones are
+	// set.
+	Update []string
+	// DoNothing leaves existing row unchanged.
+	DoNothing bool
+}
+
+// Upsert inserts item or, if row with the same values of conflict columns
+// exists already, updates all other columns of that row but creation time
+// and version, within single statement. Unlike Save, it works for rows with
+// natural keys. Generated primary key is stored in item only if dialect
+// supports RETURNING clause. Version of the row, kept on conflict, is read
+// back into item with another query, so that item can be saved later.
+func (m *TableMapping) Upsert(item interface{}, conflict ...string) error {
+	return m.UpsertWith(item, Conflict{Columns: conflict})
+}
+
+// UpsertWith works like Upsert, but allows to choose columns that are
+// updated on conflict or to leave existing row unchanged.
+func (m *TableMapping) UpsertWith(item interface{}, conflict Conflict) error {
+	table, err := m.tableinfo()
+	if err != nil {
+		return err
+	}
+	val := reflect.ValueOf(item)
+	for val.Type().Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Type().Kind() != reflect.Struct {
+		return ErrInvalidItem
+	}
+	if err := beforeSave(m.session, val); err != nil {
+		return err
+	}
+	dialect := m.session.dialect
+	fields := structmapFor(table, val.Type())
+	columns, args, generated := m.writable(fields, val, true)
+	if len(columns) == 0 {
+		return ErrInvalidItem
+	}
+
+	update := conflict.Update
+	if conflict.DoNothing {
+		update = nil
+	} else if update == nil {
+		// version of existing row is kept, so that it is not reset to the
+		// first one
+		for _, f := range fields.fields {
+			column := f.column.dbname
+			if contains(columns, column) && !contains(conflict.Columns, column) && !f.pk && !f.createstamp && !f.version {
+				update = append(update, column)
 			}
 		}
-		sql := strings.Join(sqlChunks, "")
-		res, err := m.session.Exec(sql, args...)
-		if err != nil {
-			return created, err
+	}
+	for _, list := range [][]string{conflict.Columns, update} {
+		for _, column := range list {
+			if !table.has(column) {
+				return fmt.Errorf("%w: table %s has no column %s", ErrInvalidItem, table.name, column)
+			}
 		}
-		id, err := res.LastInsertId()
-		// we cannot assume that the primary key is number, so just skip this one
-		if err == nil {
-			pkfield.SetInt(id)
+	}
+	if len(update) != 0 && len(conflict.Columns) == 0 {
+		return fmt.Errorf("%w: conflict columns of update are not set", ErrInvalidQuery)
+	}
+
+	var returning string
+	if generated != nil && dialect.Returning(generated.column.dbname) != "" {
+		returning = generated.column.dbname
+	}
+	sqlquery := newSQLBuilder(dialect).insertRows(table.name, columns, 1, args)
+	sqlquery.write(dialect.Upsert(columns, conflict.Columns, update)).returning(returning)
+	if returning == "" {
+		if _, err := m.session.Exec(sqlquery.String(), sqlquery.args...); err != nil {
+			return err
+		}
+	} else {
+		// nothing is returned if existing row was left unchanged
+		batch := &insertBatch{generated: generated, items: []reflect.Value{val}}
+		if _, err := m.insertReturning(sqlquery, batch); err != nil {
+			return err
 		}
 	}
+	if version := fields.versionField(); version != nil && len(conflict.Columns) != 0 {
+		if err := m.readVersion(version, val, conflict.Columns, columns, args); err != nil {
+			return err
+		}
+	}
+	return afterSave(m.session, val)
+}
 
-	return created, nil
+// readVersion loads version of row with given values of conflict columns
+// into struct value. Values are taken from args of inserted columns. Version
+// is left as it is if any of conflict columns was not inserted.
+func (m *TableMapping) readVersion(version *fieldmap, val reflect.Value, conflict, columns []string, args []interface{}) error {
+	values := make([]interface{}, len(conflict))
+	for i, column := range conflict {
+		found := false
+		for j := range columns {
+			if columns[j] == column {
+				values[i], found = args[j], true
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	sqlquery := newSQLBuilder(m.session.dialect)
+	sqlquery.selectFrom(m.name, []string{version.column.dbname}).whereEq(conflict, values)
+	rows, err := m.session.Query(sqlquery.String(), sqlquery.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return m.session.canceled(m.session.context(), rows.Err())
+	}
+	var stored int64
+	if err := rows.Scan(&stored); err != nil {
+		return err
+	}
+	setVersion(val.FieldByIndex(version.index), stored)
+	return nil
 }
 
+// writable sets timestamp fields of given struct value and returns columns
+// written by INSERT or UPDATE of it (see structmap.writable). Times are
+// converted to format of the dialect.
+func (m *TableMapping) writable(fields *structmap, val reflect.Value, created bool) ([]string, []interface{}, *fieldmap) {
+	fields.stamp(val, m.session.now(), created)
+	if version := fields.versionField(); version != nil && created {
+		// the first version of the row, unless set explicitly
+		if f := val.FieldByIndex(version.index); versionOf(f) == 0 {
+			setVersion(f, 1)
+		}
+	}
+	columns, args, generated := fields.writable(val, created)
+	if deleted := m.deletedColumn(fields.table); deleted != "" {
+		// rows are marked as deleted only by Delete and unmarked by Restore
+		for i, column := range columns {
+			if column == deleted {
+				columns = append(columns[:i], columns[i+1:]...)
+				args = append(args[:i], args[i+1:]...)
+				break
+			}
+		}
+	}
+	for i, arg := range args {
+		switch t := arg.(type) {
+		case *time.Time:
+			args[i] = m.session.dialect.FormatTime(*t)
+		case **time.Time:
+			if *t != nil {
+				args[i] = m.session.dialect.FormatTime(**t)
+			}
+		}
+	}
+	return columns, args, generated
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Get loads row with given primary key into dest. Values of composite key
+// must be given in order its columns are declared in the key.
+func (m *TableMapping) Get(dest interface{}, key ...interface{}) error {
+	table, err := m.tableinfo()
+	if err != nil {
+		return err
+	}
+	val := reflect.ValueOf(dest)
+	for val.Type().Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Type().Kind() != reflect.Struct {
+		return ErrInvalidItem
+	}
+	fields := structmapFor(table, val.Type())
+	if len(fields.key) == 0 || len(key) != len(fields.key) {
+		return fmt.Errorf("%w: expected %d values, got %d", ErrIncompleteKey, len(fields.key), len(key))
+	}
+	q := m.Query()
+	for i, column := range fields.key {
+		q.Where(Eq(column.dbname, key[i]))
+	}
+	return q.One(dest)
+}
+
+// Delete removes row of given item. Row of table in soft delete mode is
+// marked as deleted instead (see SoftDelete).
 func (m *TableMapping) Delete(item interface{}) error {
+	return m.delete(item, false)
+}
+
+func (m *TableMapping) delete(item interface{}, hard bool) error {
 	table, err := m.tableinfo()
 	if err != nil {
 		return err
@@ -113,14 +516,31 @@ func (m *TableMapping) Delete(item interface{}) error {
 	if val.Type().Kind() != reflect.Struct {
 		return ErrInvalidItem
 	}
-	pkval := val.FieldByName(table.pkfield.name)
-	if !pkval.IsValid() {
-		return ErrInvalidItem
+	fields := structmapFor(table, val.Type())
+	keycols, keyvals, err := fields.keyvalues(val)
+	if err != nil {
+		return err
+	}
+	if err := beforeDelete(m.session, val); err != nil {
+		return err
+	}
+
+	if column := m.deletedColumn(table); column != "" && !hard {
+		err = m.softDelete(table, column, fields, val, keycols, keyvals)
+	} else {
+		sqlquery := newSQLBuilder(m.session.dialect).delete(table.name)
+		err = m.execOne(sqlquery.whereEq(keycols, keyvals))
+	}
+	if err != nil {
+		return err
 	}
+	return afterDelete(m.session, val)
+}
 
-	sqlChunks := []string{`DELETE FROM "`, table.name, `" WHERE "`, table.pkfield.name, `" = ?`}
-	sql := strings.Join(sqlChunks, "")
-	res, err := m.session.Exec(sql, pkval.Interface())
+// execOne runs statement that should affect exactly one row, ErrNotFound is
+// returned otherwise
+func (m *TableMapping) execOne(sqlquery *sqlbuilder) error {
+	res, err := m.session.Exec(sqlquery.String(), sqlquery.args...)
 	if err != nil {
 		return err
 	}
@@ -134,6 +554,19 @@ func (m *TableMapping) Delete(item interface{}) error {
 	return nil
 }
 
+// exists tells if row with given column values exists
+func (m *TableMapping) exists(columns []string, values []interface{}) (bool, error) {
+	sqlquery := newSQLBuilder(m.session.dialect)
+	sqlquery.write("SELECT 1 FROM ").ident(m.name).whereEq(columns, values).paging(1, -1)
+	rows, err := m.session.Query(sqlquery.String(), sqlquery.args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	exists := rows.Next()
+	return exists, m.session.canceled(m.session.context(), rows.Err())
+}
+
 func (m *TableMapping) tableinfo() (*tableinfo, error) {
 	table, err := m.session.dialect.TableInfo(m.session.db, m.name)
 	if err != nil {
@@ -2,7 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 )
 
 func TestMappingSave(t *testing.T) {
@@ -60,3 +63,377 @@ func TestMappingDelete(t *testing.T) {
 		}
 	})
 }
+
+type TaggedUser struct {
+	UserID   int64  `db:"id"`
+	FullName string `db:"name"`
+	Age      int64  `db:",readonly"`
+	Name     string
+	Ignored  string `db:"-"`
+}
+
+func TestMappingTaggedSave(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		users := session.Table("users")
+
+		user := &TaggedUser{}
+		if err := users.Query().Where("name =", "bob").One(user); err != nil {
+			t.Fatalf("cannot fetch bob: %s", err)
+		}
+		if user.UserID != 1 || user.FullName != "bob" || user.Age != 32 || user.Name != "" {
+			t.Fatalf("tagged fields not mapped: %#v", user)
+		}
+
+		user.FullName = "bobby"
+		user.Age = 99
+		if _, err := users.Save(user); err != nil {
+			t.Fatalf("cannot save bob: %s", err)
+		}
+
+		var name string
+		var age int64
+		if err := session.Commit(); err != nil {
+			t.Fatalf("cannot commit: %s", err)
+		}
+		row := db.QueryRow("SELECT name, age FROM users WHERE id = 1")
+		if err := row.Scan(&name, &age); err != nil {
+			t.Fatalf("cannot query users table: %s", err)
+		}
+		if name != "bobby" {
+			t.Fatalf("expected user name to be 'bobby', got '%s'", name)
+		}
+		if age != 32 {
+			t.Fatalf("readonly column was written, age is %d", age)
+		}
+	})
+}
+
+func TestMappingPkOverride(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		type userByName struct {
+			Name string `db:"name,pk"`
+		}
+		if err := session.Table("users").Delete(&userByName{Name: "mike"}); err != nil {
+			t.Fatalf("cannot delete user by name: %s", err)
+		}
+		if count, err := session.Table("users").Query().Count(); err != nil {
+			t.Fatalf("cannot count users: %s", err)
+		} else if count != 2 {
+			t.Fatalf("expected 2 users, got %d", count)
+		}
+	})
+}
+
+type Membership struct {
+	TenantId int64
+	UserId   int64
+	Role     string
+}
+
+func TestMappingCompositeKey(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		memberships := session.Table("memberships")
+
+		table, err := memberships.tableinfo()
+		if err != nil {
+			t.Fatalf("cannot read table info: %s", err)
+		}
+		if len(table.pkfields) != 2 || table.pkfields[0].dbname != "tenant_id" || table.pkfields[1].dbname != "user_id" {
+			t.Fatalf("invalid primary key: %#v", table.pkfields)
+		}
+
+		m := &Membership{}
+		if err := memberships.Get(m, 1, 2); err != nil {
+			t.Fatalf("cannot get membership: %s", err)
+		}
+		if m.TenantId != 1 || m.UserId != 2 || m.Role != "member" {
+			t.Fatalf("unexpected membership: %#v", m)
+		}
+		if err := memberships.Get(m, 1); !errors.Is(err, ErrIncompleteKey) {
+			t.Fatalf("expected incomplete key error, got %v", err)
+		}
+
+		m.Role = "admin"
+		if created, err := memberships.Save(m); err != nil {
+			t.Fatalf("cannot save membership: %s", err)
+		} else if created {
+			t.Fatal("existing membership should be updated")
+		}
+
+		// all parts of the key are set, but there is no such row yet
+		created, err := memberships.Save(&Membership{TenantId: 2, UserId: 1, Role: "member"})
+		if err != nil {
+			t.Fatalf("cannot save membership: %s", err)
+		} else if !created {
+			t.Fatal("new membership should be created")
+		}
+
+		if count, err := memberships.Query().Where("role =", "admin").Count(); err != nil {
+			t.Fatalf("cannot count memberships: %s", err)
+		} else if count != 2 {
+			t.Fatalf("expected 2 admins, got %d", count)
+		}
+
+		if _, err := memberships.Save(&Membership{TenantId: 3, Role: "member"}); !errors.Is(err, ErrIncompleteKey) {
+			t.Fatalf("expected incomplete key error, got %v", err)
+		}
+		if err := memberships.Delete(&Membership{TenantId: 1}); !errors.Is(err, ErrIncompleteKey) {
+			t.Fatalf("expected incomplete key error, got %v", err)
+		}
+		if err := memberships.Delete(&Membership{TenantId: 2, UserId: 1}); err != nil {
+			t.Fatalf("cannot delete membership: %s", err)
+		}
+		if err := memberships.Get(m, 2, 1); err != ErrNotFound {
+			t.Fatalf("membership should be deleted: %v", err)
+		}
+	})
+}
+
+func TestMappingInsertAll(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		// more users than bind parameters of single statement
+		users := make([]User, 1500)
+		for i := range users {
+			users[i].Name = fmt.Sprintf("user%d", i)
+		}
+		if err := session.Table("users").InsertAll(users); err != nil {
+			t.Fatalf("cannot insert users: %s", err)
+		}
+		count, err := session.Table("users").Query().Where(Gt("id", 3)).Count()
+		if err != nil {
+			t.Fatalf("cannot count users: %s", err)
+		}
+		if count != 1500 {
+			t.Fatalf("expected 1500 inserted users, got %d", count)
+		}
+
+		memberships := []*Membership{{UserId: 3, TenantId: 1, Role: "member"}, {UserId: 3, TenantId: 2}}
+		if err := session.Table("memberships").InsertAll(&memberships); err != nil {
+			t.Fatalf("cannot insert memberships: %s", err)
+		}
+		if count, _ := session.Table("memberships").Query().Where("user_id =", 3).Count(); count != 2 {
+			t.Fatalf("expected 2 inserted memberships, got %d", count)
+		}
+
+		if err := session.Table("users").InsertAll(&User{}); err != ErrInvalidItem {
+			t.Fatalf("expected invalid item error, got %v", err)
+		}
+	})
+}
+
+func TestMappingUpsert(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		memberships := session.Table("memberships")
+
+		role := func(tenant, user int64) string {
+			m := &Membership{}
+			if err := memberships.Get(m, tenant, user); err != nil {
+				t.Fatalf("cannot get membership: %s", err)
+			}
+			return m.Role
+		}
+
+		if err := memberships.Upsert(&Membership{TenantId: 1, UserId: 2, Role: "owner"}, "tenant_id", "user_id"); err != nil {
+			t.Fatalf("cannot upsert existing membership: %s", err)
+		}
+		if r := role(1, 2); r != "owner" {
+			t.Fatalf("existing membership should be updated, got role %q", r)
+		}
+		if err := memberships.Upsert(&Membership{TenantId: 2, UserId: 2, Role: "member"}, "tenant_id", "user_id"); err != nil {
+			t.Fatalf("cannot upsert new membership: %s", err)
+		}
+		if r := role(2, 2); r != "member" {
+			t.Fatalf("new membership should be inserted, got role %q", r)
+		}
+
+		conflict := Conflict{Columns: []string{"tenant_id", "user_id"}, DoNothing: true}
+		if err := memberships.UpsertWith(&Membership{TenantId: 1, UserId: 1, Role: "guest"}, conflict); err != nil {
+			t.Fatalf("cannot upsert membership: %s", err)
+		}
+		if r := role(1, 1); r != "admin" {
+			t.Fatalf("existing membership should be left unchanged, got role %q", r)
+		}
+
+		err := memberships.Upsert(&Membership{TenantId: 1, UserId: 1, Role: "guest"})
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("expected invalid query error without conflict columns, got %v", err)
+		}
+
+		// primary key of existing row is never changed
+		users := session.Table("users")
+		if err := users.Upsert(&TrackedUser{Id: 50, Name: "bob", Age: 33}, "name"); err != nil {
+			t.Fatalf("cannot upsert user: %s", err)
+		}
+		user := &TrackedUser{}
+		if err := users.Get(user, 1); err != nil {
+			t.Fatalf("existing user should keep its key: %s", err)
+		}
+		if user.Age != 33 {
+			t.Fatalf("existing user should be updated, got %#v", user)
+		}
+	})
+}
+
+type Article struct {
+	Id        int64
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
+
+func TestMappingTimestamps(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+		session := Use(db, Sqlite3Dialect).WithClock(func() time.Time { return now })
+		articles := session.Table("articles")
+
+		article := &Article{Title: "first"}
+		if _, err := articles.Save(article); err != nil {
+			t.Fatalf("cannot save article: %s", err)
+		}
+		if !article.CreatedAt.Equal(now) || article.UpdatedAt == nil || !article.UpdatedAt.Equal(now) {
+			t.Fatalf("timestamps were not set: %#v", article)
+		}
+		if err := session.Commit(); err != nil {
+			t.Fatalf("cannot commit: %s", err)
+		}
+		var stored string
+		row := db.QueryRow("SELECT CAST(created_at AS TEXT) FROM articles")
+		if err := row.Scan(&stored); err != nil {
+			t.Fatalf("cannot read stored time: %s", err)
+		}
+		if stored != "2020-01-02 02:04:05+00:00" {
+			t.Fatalf("time should be stored as UTC text, got %q", stored)
+		}
+		// times in conditions are compared with stored ones in UTC
+		if exists, err := articles.Query().Where(Between("created_at", now, now)).Exists(); err != nil || !exists {
+			t.Fatalf("article should be found by creation time, got %v (%v)", exists, err)
+		}
+		updated := now.Add(time.Minute)
+		if n, err := articles.Query().Where(Eq("created_at", now)).Update(map[string]interface{}{"updated_at": &updated}); err != nil || n != 1 {
+			t.Fatalf("cannot update article by creation time, got %d (%v)", n, err)
+		}
+		if exists, err := articles.Query().Where(Eq("updated_at", updated)).Exists(); err != nil || !exists {
+			t.Fatalf("article should be found by update time, got %v (%v)", exists, err)
+		}
+
+		created := now
+		now = now.Add(time.Hour)
+		article.Title = "changed"
+		article.CreatedAt = time.Time{}
+		if _, err := articles.Save(article); err != nil {
+			t.Fatalf("cannot save article: %s", err)
+		}
+		loaded := &Article{}
+		if err := articles.Get(loaded, article.Id); err != nil {
+			t.Fatalf("cannot get article: %s", err)
+		}
+		if !loaded.CreatedAt.Equal(created) || !loaded.UpdatedAt.Equal(now) {
+			t.Fatalf("only update time should change, got %s and %s", loaded.CreatedAt, loaded.UpdatedAt)
+		}
+
+		now = now.Add(time.Hour)
+		if err := articles.Upsert(&Article{Title: "changed"}, "title"); err != nil {
+			t.Fatalf("cannot upsert article: %s", err)
+		}
+		if err := articles.Get(loaded, article.Id); err != nil {
+			t.Fatalf("cannot get article: %s", err)
+		}
+		if !loaded.CreatedAt.Equal(created) || !loaded.UpdatedAt.Equal(now) {
+			t.Fatalf("only update time should change on conflict, got %s and %s", loaded.CreatedAt, loaded.UpdatedAt)
+		}
+	})
+}
+
+type Document struct {
+	Id      int64
+	Body    string
+	Version int64
+}
+
+type RevisedDocument struct {
+	Id       int64
+	Body     string
+	Revision uint32 `db:"version,version"`
+}
+
+func TestMappingVersion(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		documents := session.Table("documents")
+
+		doc := &Document{Body: "draft"}
+		if _, err := documents.Save(doc); err != nil {
+			t.Fatalf("cannot save document: %s", err)
+		}
+		if doc.Version != 1 {
+			t.Fatalf("created document should be of version 1, got %d", doc.Version)
+		}
+
+		first, second := &Document{}, &Document{}
+		if err := documents.Get(first, doc.Id); err != nil {
+			t.Fatalf("cannot get document: %s", err)
+		}
+		if err := documents.Get(second, doc.Id); err != nil {
+			t.Fatalf("cannot get document: %s", err)
+		}
+
+		first.Body = "first"
+		if _, err := documents.Save(first); err != nil {
+			t.Fatalf("cannot save document: %s", err)
+		}
+		if first.Version != 2 {
+			t.Fatalf("version should be incremented, got %d", first.Version)
+		}
+		second.Body = "second"
+		if _, err := documents.Save(second); !errors.Is(err, ErrStaleObject) {
+			t.Fatalf("expected stale object error, got %v", err)
+		}
+		if second.Version != 1 {
+			t.Fatalf("version of stale object should not change, got %d", second.Version)
+		}
+
+		loaded := &Document{}
+		if err := documents.Get(loaded, doc.Id); err != nil {
+			t.Fatalf("cannot get document: %s", err)
+		}
+		if loaded.Body != "first" || loaded.Version != 2 {
+			t.Fatalf("stale save should not overwrite row, got %#v", loaded)
+		}
+
+		upserted := &Document{Id: doc.Id, Body: "upserted"}
+		if err := documents.Upsert(upserted, "id"); err != nil {
+			t.Fatalf("cannot upsert document: %s", err)
+		}
+		if upserted.Version != 2 {
+			t.Fatalf("upserted item should hold version of existing row, got %d", upserted.Version)
+		}
+		if err := documents.Get(loaded, doc.Id); err != nil {
+			t.Fatalf("cannot get document: %s", err)
+		}
+		if loaded.Body != "upserted" || loaded.Version != 2 {
+			t.Fatalf("upsert should keep version of existing row, got %#v", loaded)
+		}
+		upserted.Body = "saved"
+		if _, err := documents.Save(upserted); err != nil {
+			t.Fatalf("upserted item should be saved, got %v", err)
+		}
+
+		revised := &RevisedDocument{Body: "draft"}
+		for i := 1; i <= 2; i++ {
+			if _, err := documents.Save(revised); err != nil {
+				t.Fatalf("cannot save document: %s", err)
+			}
+			if revised.Revision != uint32(i) {
+				t.Fatalf("expected revision %d, got %d", i, revised.Revision)
+			}
+		}
+	})
+}
@@ -1,18 +1,29 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"reflect"
-	"strings"
+	"sort"
 )
 
 type Query struct {
-	mapping    *TableMapping
-	filtercond []string
-	filtervals []interface{}
-	limit      int64
-	offset     int64
-	order      order
+	mapping  *TableMapping
+	ctx      context.Context
+	filter   []Cond
+	limit    int64
+	offset   int64
+	order    order
+	group    []string
+	having   []Cond
+	joins    []join
+	selects  []string
+	distinct bool
+	deleted  deletedScope
+	preloads []string
+	// err is set by invalid use of builder methods and returned by the query
+	err error
 }
 
 type order struct {
@@ -20,12 +31,35 @@ type order struct {
 	desc []string
 }
 
-func (q *Query) Where(cond string, val interface{}) *Query {
-	q.filtercond = append(q.filtercond, cond)
-	q.filtervals = append(q.filtervals, val)
+// Where adds condition that fetched rows must match. All conditions are
+// joined with AND. Condition is either a Cond or a string, written as with
+// Expr:
+//
+//	Where("name =", "bob")
+//	Where(Or(IsNull("age"), Gt("age", 20)))
+func (q *Query) Where(cond interface{}, vals ...interface{}) *Query {
+	if c := q.cond(cond, vals); c != nil {
+		q.filter = append(q.filter, c)
+	}
 	return q
 }
 
+// cond returns condition given to Where or Having. Invalid condition is
+// reported by the query.
+func (q *Query) cond(cond interface{}, vals []interface{}) Cond {
+	switch cond := cond.(type) {
+	case Cond:
+		if len(vals) != 0 {
+			q.err = fmt.Errorf("%w: values given with %T", ErrInvalidCondition, cond)
+		}
+		return cond
+	case string:
+		return Expr(cond, vals...)
+	}
+	q.err = fmt.Errorf("%w: %T", ErrInvalidCondition, cond)
+	return nil
+}
+
 func (q *Query) OrderBy(fields ...string) *Query {
 	q.order.asc = append(q.order.asc, fields...)
 	return q
@@ -46,11 +80,37 @@ func (q *Query) Offset(offset int64) *Query {
 	return q
 }
 
+// Select restricts columns fetched by One and All to given ones. Fields not
+// bound to any of them are left untouched. Column can be qualified with
+// table name, to tell apart columns of joined tables.
+func (q *Query) Select(columns ...string) *Query {
+	q.selects = append(q.selects, columns...)
+	return q
+}
+
+// Distinct makes query skip duplicate rows.
+func (q *Query) Distinct() *Query {
+	q.distinct = true
+	return q
+}
+
+// Preload makes One and All load rows related to fetched ones, using
+// relations declared on destination struct by given fields (see relation).
+// Every relation is loaded by a single query, no matter how many rows were
+// fetched.
+func (q *Query) Preload(relations ...string) *Query {
+	q.preloads = append(q.preloads, relations...)
+	return q
+}
+
+// WithContext sets context used by the query, instead of the one session
+// was configured with.
+func (q *Query) WithContext(ctx context.Context) *Query {
+	q.ctx = ctx
+	return q
+}
+
 func (q *Query) One(dest interface{}) error {
-	table, err := q.mapping.tableinfo()
-	if err != nil {
-		return err
-	}
 	structval := reflect.ValueOf(dest)
 	for structval.Type().Kind() == reflect.Ptr {
 		structval = structval.Elem()
@@ -58,36 +118,39 @@ func (q *Query) One(dest interface{}) error {
 	if structval.Type().Kind() != reflect.Struct {
 		return ErrInvalidItem
 	}
-	sqlargs := q.sqlargs(table, structval)
-	if len(sqlargs) == 0 {
-		return ErrInvalidItem
-	}
-	sqlquery := q.sqlquery(table, structval)
-	rows, err := q.mapping.session.Query(sqlquery, q.filtervals...)
+	rows, jm, err := q.open(structval.Type())
 	if err != nil {
-		q.mapping.session.log.Error("select query error: %s\n%s", err, sqlquery)
 		return err
 	}
 	defer rows.Close()
 
 	if !rows.Next() {
+		if err := q.rowsErr(rows); err != nil {
+			return err
+		}
 		return ErrNotFound
 	}
+	sqlargs := jm.scanargs(structval, make([]interface{}, jm.columns))
 	if err := rows.Scan(sqlargs...); err != nil {
 		return err
 	}
+	jm.assign(structval, sqlargs)
+	jm.remember(structval)
 	if rows.Next() {
 		return ErrMultipleRowsFound
 	}
+	if err := q.rowsErr(rows); err != nil {
+		return err
+	}
+	rows.Close()
 
-	return nil
+	if err := q.preload([]reflect.Value{structval}); err != nil {
+		return err
+	}
+	return afterLoad(q.mapping.session, structval)
 }
 
 func (q *Query) All(dest interface{}) error {
-	table, err := q.mapping.tableinfo()
-	if err != nil {
-		return err
-	}
 	slice := reflect.ValueOf(dest)
 	for slice.Type().Kind() == reflect.Ptr {
 		slice = slice.Elem()
@@ -109,139 +172,316 @@ func (q *Query) All(dest interface{}) error {
 		return ErrInvalidItem
 	}
 
-	sqlquery := q.sqlquery(table, reflect.New(itemTp).Elem())
-	rows, err := q.mapping.session.Query(sqlquery, q.filtervals...)
+	rows, jm, err := q.open(itemTp)
 	if err != nil {
-		q.mapping.session.log.Error("select query error: %s\n%s", err, sqlquery)
 		return err
 	}
 	defer rows.Close()
 
+	fetched := slice.Len()
+	sqlargs := make([]interface{}, jm.columns)
 	for rows.Next() {
 		structval := reflect.New(itemTp)
-		sqlargs := q.sqlargs(table, structval.Elem())
-		if len(sqlargs) == 0 {
-			q.mapping.session.log.Error("query destination does not map source table")
-			return ErrInvalidItem
-		}
-		if err := rows.Scan(sqlargs...); err != nil {
+		if err := rows.Scan(jm.scanargs(structval.Elem(), sqlargs)...); err != nil {
 			q.mapping.session.log.Error("cannot scan result row: %s", err)
 			return err
 		}
+		jm.assign(structval.Elem(), sqlargs)
+		jm.remember(structval.Elem())
 		if itemTpIsPtr {
 			slice.Set(reflect.Append(slice, structval))
 		} else {
 			slice.Set(reflect.Append(slice, reflect.Indirect(structval)))
 		}
 	}
+	if err := q.rowsErr(rows); err != nil {
+		return err
+	}
+	rows.Close()
+
+	items := make([]reflect.Value, 0, slice.Len()-fetched)
+	for i := fetched; i < slice.Len(); i++ {
+		items = append(items, reflect.Indirect(slice.Index(i)))
+	}
+	if err := q.preload(items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := afterLoad(q.mapping.session, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open runs select query of rows scanned into structures of given type
+func (q *Query) open(tp reflect.Type) (*sql.Rows, *joinmap, error) {
+	table, err := q.tableinfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	jm, err := q.joinmap(tp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(jm.parts[0].fields.fields) == 0 {
+		q.mapping.session.log.Error("query destination does not map source table")
+		return nil, nil, ErrInvalidItem
+	}
+	sqlquery := q.sqlquery(table, jm)
+	rows, err := q.query(sqlquery)
+	if err != nil {
+		q.mapping.session.log.Error("select query error: %s\n%s", err, sqlquery)
+		return nil, nil, err
+	}
+	return rows, jm, nil
+}
+
+// Pluck fetches values of single column of matching rows into dest, which
+// must be pointer to slice of values column can be scanned into.
+func (q *Query) Pluck(column string, dest interface{}) error {
+	table, err := q.tableinfo()
+	if err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice {
+		q.mapping.session.log.Error("query Pluck() destination is not pointer to slice")
+		return ErrInvalidItem
+	}
+	slice = slice.Elem()
+
+	sqlquery := newSQLBuilder(q.mapping.session.dialect)
+	sqlquery.write("SELECT ")
+	if q.distinct {
+		sqlquery.write("DISTINCT ")
+	}
+	sqlquery.column(column).write(" FROM ").ident(table.name).joins(q.joins)
+	q.clauses(table, sqlquery)
+	rows, err := q.query(sqlquery)
+	if err != nil {
+		q.mapping.session.log.Error("pluck query error: %s\n%s", err, sqlquery)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		val := reflect.New(slice.Type().Elem())
+		if err := rows.Scan(val.Interface()); err != nil {
+			q.mapping.session.log.Error("cannot scan result row: %s", err)
+			return err
+		}
+		slice.Set(reflect.Append(slice, val.Elem()))
+	}
+	return q.rowsErr(rows)
+}
+
+// Update sets given columns of all matching rows to given values and returns
+// number of updated rows. Query must not be joined, grouped or paged.
+func (q *Query) Update(values map[string]interface{}) (int64, error) {
+	table, err := q.tableinfo()
+	if err != nil {
+		return 0, err
+	}
+	if err := q.setbased(); err != nil {
+		return 0, err
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		if !table.has(column) {
+			return 0, fmt.Errorf("%w: table %s has no column %s", ErrInvalidItem, table.name, column)
+		}
+		columns = append(columns, column)
+	}
+	// keep statements the same for the same columns
+	sort.Strings(columns)
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		args[i] = values[column]
+	}
+	sqlquery := newSQLBuilder(q.mapping.session.dialect).update(table.name, columns, args)
+	return q.exec(sqlquery.where(q.conds(table)))
+}
+
+// Delete removes all matching rows and returns their number. Rows of table
+// in soft delete mode are marked as deleted instead (see
+// TableMapping.SoftDelete). Query must not be joined, grouped or paged.
+func (q *Query) Delete() (int64, error) {
+	return q.delete(false)
+}
+
+// HardDelete works like Delete, but always removes rows, including those
+// marked as deleted if query selects them.
+func (q *Query) HardDelete() (int64, error) {
+	return q.delete(true)
+}
+
+func (q *Query) delete(hard bool) (int64, error) {
+	table, err := q.tableinfo()
+	if err != nil {
+		return 0, err
+	}
+	if err := q.setbased(); err != nil {
+		return 0, err
+	}
+	dialect := q.mapping.session.dialect
+	column := q.mapping.deletedColumn(table)
+	if hard || column == "" {
+		sqlquery := newSQLBuilder(dialect).delete(table.name)
+		return q.exec(sqlquery.where(q.conds(table)))
+	}
+	// rows deleted already keep their deletion time
+	now := dialect.FormatTime(q.mapping.session.now())
+	sqlquery := newSQLBuilder(dialect).update(table.name, []string{column}, []interface{}{now})
+	conds := append(append([]Cond(nil), q.conds(table)...), IsNull(column))
+	return q.exec(sqlquery.where(conds))
+}
+
+// setbased tells if query can be used to update or delete rows. Clauses that
+// cannot be used would make statement affect different rows than the query
+// selects, so they are rejected instead of ignored.
+func (q *Query) setbased() error {
+	if len(q.joins) != 0 || len(q.group) != 0 || len(q.having) != 0 || q.limit > -1 || q.offset > -1 {
+		return fmt.Errorf("%w: joins, grouping and paging cannot be used with update or delete", ErrInvalidQuery)
+	}
 	return nil
 }
 
+func (q *Query) exec(sqlquery *sqlbuilder) (int64, error) {
+	res, err := q.mapping.session.ExecContext(q.context(), sqlquery.String(), sqlquery.args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Count returns number of matching rows. Grouped query counts groups that
+// match Having conditions, distinct query counts distinct values of selected
+// columns or rows of queried table if none are selected. Paging is ignored.
 func (q *Query) Count() (count int64, err error) {
-	table, err := q.mapping.tableinfo()
+	table, err := q.tableinfo()
 	if err != nil {
 		return 0, err
 	}
-	sqlChunks := []string{`SELECT COUNT(*) FROM "`, table.name, `" `}
-	if len(q.filtercond) != 0 {
-		sqlChunks = append(sqlChunks, ` WHERE `)
-		for i, cond := range q.filtercond {
-			sqlChunks = append(sqlChunks, cond, ` ?`)
-			if i != len(q.filtercond)-1 {
-				sqlChunks = append(sqlChunks, cond, ` AND `)
-			}
+	sqlquery := newSQLBuilder(q.mapping.session.dialect)
+	if len(q.group) == 0 && len(q.having) == 0 && !q.distinct {
+		sqlquery.write("SELECT COUNT(*) FROM ").ident(table.name).joins(q.joins)
+		sqlquery.where(q.conds(table))
+	} else {
+		sqlquery.write("SELECT COUNT(*) FROM (SELECT ")
+		switch {
+		case len(q.group) != 0:
+			sqlquery.columns(q.group)
+		case len(q.having) != 0:
+			// the whole table is a single group
+			sqlquery.write("COUNT(*)")
+		case len(q.selects) != 0:
+			sqlquery.write("DISTINCT ").columns(q.selects)
+		default:
+			sqlquery.write("DISTINCT ").ident(table.name).write(".*")
 		}
+		sqlquery.write(" FROM ").ident(table.name).joins(q.joins)
+		sqlquery.where(q.conds(table)).groupBy(q.group).having(q.having)
+		sqlquery.write(") ").ident("counted")
 	}
-	sqlquery := strings.Join(sqlChunks, "")
-	rows, err := q.mapping.session.Query(sqlquery, q.filtervals...)
+	rows, err := q.query(sqlquery)
 	if err != nil {
 		q.mapping.session.log.Error("count query error: %s\n%s", err, sqlquery)
 		return 0, err
 	}
 	defer rows.Close()
-	rows.Next()
+	if !rows.Next() {
+		return 0, q.rowsErr(rows)
+	}
 	err = rows.Scan(&count)
 	return count, err
 }
 
 func (q *Query) Exists() (exists bool, err error) {
-	table, err := q.mapping.tableinfo()
+	table, err := q.tableinfo()
 	if err != nil {
 		return false, err
 	}
-	sqlChunks := []string{`SELECT 1 FROM "`, table.name, `" `}
-	if len(q.filtercond) != 0 {
-		sqlChunks = append(sqlChunks, ` WHERE `)
-		for i, cond := range q.filtercond {
-			sqlChunks = append(sqlChunks, cond, ` ?`)
-			if i != len(q.filtercond)-1 {
-				sqlChunks = append(sqlChunks, cond, ` AND `)
-			}
-		}
-	}
-	sqlChunks = append(sqlChunks, " LIMIT 1")
-	sqlquery := strings.Join(sqlChunks, "")
-	rows, err := q.mapping.session.Query(sqlquery, q.filtervals...)
+	sqlquery := newSQLBuilder(q.mapping.session.dialect)
+	sqlquery.write("SELECT 1 FROM ").ident(table.name).joins(q.joins)
+	sqlquery.where(q.conds(table)).groupBy(q.group).having(q.having).paging(1, -1)
+	rows, err := q.query(sqlquery)
 	if err != nil {
 		q.mapping.session.log.Error("exists test query error: %s\n%s", err, sqlquery)
 		return false, err
 	}
 	exists = rows.Next()
+	err = q.rowsErr(rows)
 	rows.Close()
 	return exists, err
 }
 
-func (q *Query) sqlargs(table *tableinfo, structval reflect.Value) (args []interface{}) {
-	args = make([]interface{}, 0, structval.NumField())
-	for _, field := range table.fields {
-		f := structval.FieldByName(field.name)
-		if f.IsValid() {
-			args = append(args, f.Addr().Interface())
+// project restricts mappings of all tables of the query to selected columns
+func (q *Query) project(parts []*joinpart) error {
+	selected := make(map[string]bool, len(q.selects))
+	for _, column := range q.selects {
+		selected[column] = true
+	}
+	found := make(map[string]bool, len(q.selects))
+	for _, part := range parts {
+		table := part.fields.table.name
+		part.fields = part.fields.filter(func(f *fieldmap) bool {
+			for _, name := range []string{f.column.dbname, table + "." + f.column.dbname} {
+				if selected[name] {
+					found[name] = true
+					return true
+				}
+			}
+			return false
+		})
+	}
+	for _, column := range q.selects {
+		if !found[column] {
+			return fmt.Errorf("%w: selected column %s is not mapped", ErrInvalidItem, column)
 		}
 	}
-	return args
+	return nil
 }
 
-func (q *Query) sqlquery(table *tableinfo, structval reflect.Value) (sql string) {
-	sqlChunks := make([]string, 0, 12)
-
-	sqlChunks = append(sqlChunks, `SELECT "`)
-	for _, field := range table.fields {
-		f := structval.FieldByName(field.name)
-		if f.IsValid() {
-			sqlChunks = append(sqlChunks, field.dbname, `", "`)
-		}
+// tableinfo returns info of queried table or error of invalid query
+func (q *Query) tableinfo() (*tableinfo, error) {
+	if q.err != nil {
+		return nil, q.err
 	}
-	sqlChunks[len(sqlChunks)-1] = `" FROM `
-	sqlChunks = append(sqlChunks, `"`, table.name, `"`)
+	return q.mapping.tableinfo()
+}
 
-	if len(q.filtercond) != 0 {
-		sqlChunks = append(sqlChunks, ` WHERE `)
-		for i, cond := range q.filtercond {
-			sqlChunks = append(sqlChunks, cond, ` ?`)
-			if i != len(q.filtercond)-1 {
-				sqlChunks = append(sqlChunks, cond, ` AND `)
-			}
-		}
+func (q *Query) context() context.Context {
+	if q.ctx == nil {
+		return q.mapping.session.context()
 	}
+	return q.ctx
+}
 
-	if len(q.order.asc) != 0 || len(q.order.desc) != 0 {
-		sqlChunks = append(sqlChunks, " ORDER BY ")
-		for _, name := range q.order.asc {
-			sqlChunks = append(sqlChunks, `"`, name, `" ASC`, `, `)
-		}
-		for _, name := range q.order.desc {
-			sqlChunks = append(sqlChunks, `"`, name, `" DESC`, `, `)
-		}
-		sqlChunks[len(sqlChunks)-1] = " "
-	}
+func (q *Query) query(sqlquery *sqlbuilder) (*sql.Rows, error) {
+	return q.mapping.session.QueryContext(q.context(), sqlquery.String(), sqlquery.args...)
+}
 
-	if q.limit > -1 {
-		sqlChunks = append(sqlChunks, fmt.Sprintf(` LIMIT %d `, q.limit))
-	}
-	if q.offset > -1 {
-		sqlChunks = append(sqlChunks, fmt.Sprintf(` OFFSET %d `, q.offset))
-	}
+// rowsErr returns error that interrupted iteration over rows, if any
+func (q *Query) rowsErr(rows *sql.Rows) error {
+	return q.mapping.session.canceled(q.context(), rows.Err())
+}
+
+func (q *Query) sqlquery(table *tableinfo, jm *joinmap) *sqlbuilder {
+	sqlquery := newSQLBuilder(q.mapping.session.dialect)
+	jm.selectFrom(sqlquery, table.name, q.joins, q.distinct)
+	return q.clauses(table, sqlquery)
+}
 
-	return strings.Join(sqlChunks, "")
+// clauses writes all clauses of the query following FROM
+func (q *Query) clauses(table *tableinfo, sqlquery *sqlbuilder) *sqlbuilder {
+	sqlquery.where(q.conds(table))
+	sqlquery.groupBy(q.group)
+	sqlquery.having(q.having)
+	sqlquery.orderBy(q.order.asc, q.order.desc)
+	sqlquery.paging(q.limit, q.offset)
+	return sqlquery
 }
@@ -2,6 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
 	"testing"
 )
 
@@ -111,3 +114,234 @@ func TestMappingQuery(t *testing.T) {
 		}()
 	})
 }
+
+func benchmarkRows(n int) [][]driver.Value {
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i), "user"}
+	}
+	return rows
+}
+
+// BenchmarkQueryAll measures fetching big result set with mapping computed
+// once per struct type.
+func BenchmarkQueryAll(b *testing.B) {
+	withPostgres(b, func(session *Session, fake *fakeDB) {
+		fake.on(`SELECT "id", "name"`, []string{"id", "name"}, benchmarkRows(10000)...)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			users := make([]*User, 0, 10000)
+			if err := session.Table("users").Query().All(&users); err != nil {
+				b.Fatalf("cannot query users: %s", err)
+			}
+		}
+	})
+}
+
+// BenchmarkQueryAllFieldByName measures the same, but looking up every field
+// by name for every row, as it was done before struct mapping was cached.
+func BenchmarkQueryAllFieldByName(b *testing.B) {
+	withPostgres(b, func(session *Session, fake *fakeDB) {
+		fake.on(`SELECT "id", "name"`, []string{"id", "name"}, benchmarkRows(10000)...)
+		table, err := session.Table("users").tableinfo()
+		if err != nil {
+			b.Fatalf("cannot read table info: %s", err)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			rows, err := session.Query(`SELECT "id", "name" FROM "users"`)
+			if err != nil {
+				b.Fatalf("cannot query users: %s", err)
+			}
+			users := make([]*User, 0, 10000)
+			for rows.Next() {
+				user := reflect.New(reflect.TypeOf(User{}))
+				args := make([]interface{}, 0, len(table.fields))
+				for _, field := range table.fields {
+					f := user.Elem().FieldByName(field.name)
+					if f.IsValid() {
+						args = append(args, f.Addr().Interface())
+					}
+				}
+				if err := rows.Scan(args...); err != nil {
+					b.Fatalf("cannot scan user: %s", err)
+				}
+				users = append(users, user.Interface().(*User))
+			}
+			rows.Close()
+		}
+	})
+}
+
+func BenchmarkStructmap(b *testing.B) {
+	table := &tableinfo{
+		name: "users",
+		fields: []*tablefield{
+			{name: "Id", dbname: "id", pk: true},
+			{name: "Name", dbname: "name"},
+			{name: "Age", dbname: "age"},
+		},
+	}
+	tp := reflect.TypeOf(User{})
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			newStructmap(table, tp)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			structmapFor(table, tp)
+		}
+	})
+}
+
+func TestQueryConditions(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		cases := []struct {
+			cond     interface{}
+			vals     []interface{}
+			expected int64
+		}{
+			{Eq("name", "bob"), nil, 1},
+			{Or(Eq("name", "bob"), In("age", []int{25, 55})), nil, 3},
+			{In("id", []int64{}), nil, 0},
+			{Not(In("id", []int64{1, 2})), nil, 1},
+			{Between("age", 25, 32), nil, 2},
+			{IsNull("name"), nil, 0},
+			{And(Gt("age", 20), Lt("age", 30)), nil, 1},
+			{"age >=", []interface{}{32}, 2},
+			{"id IN", []interface{}{1, 3}, 2},
+		}
+		for _, c := range cases {
+			q := session.Table("users").Query().Where(c.cond, c.vals...)
+			count, err := q.Count()
+			if err != nil {
+				t.Fatalf("cannot count users matching %#v: %s", c.cond, err)
+			}
+			if count != c.expected {
+				t.Fatalf("expected %d users matching %#v, got %d", c.expected, c.cond, count)
+			}
+			users := make([]*User, 0)
+			if err := q.All(&users); err != nil {
+				t.Fatalf("cannot query users matching %#v: %s", c.cond, err)
+			}
+			if int64(len(users)) != count {
+				t.Fatalf("expected %d users matching %#v, got %d", count, c.cond, len(users))
+			}
+			if exists, err := q.Exists(); err != nil || exists != (count > 0) {
+				t.Fatalf("invalid exists result for %#v: %v (%v)", c.cond, exists, err)
+			}
+		}
+
+		_, err := session.Table("users").Query().Where(42).Count()
+		if !errors.Is(err, ErrInvalidCondition) {
+			t.Fatalf("expected invalid condition error, got %v", err)
+		}
+	})
+}
+
+func TestQuerySelect(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		users := make([]*User, 0)
+		if err := session.Table("users").Query().Select("id").OrderBy("id").All(&users); err != nil {
+			t.Fatalf("cannot query users: %s", err)
+		}
+		if len(users) != 3 {
+			t.Fatalf("expected 3 users, got %d", len(users))
+		}
+		for i, user := range users {
+			if user.Id != int64(i+1) || user.Name != "" {
+				t.Fatalf("only id should be fetched, got %#v", user)
+			}
+		}
+
+		names := make([]string, 0)
+		if err := session.Table("users").Query().OrderDesc("age").Pluck("name", &names); err != nil {
+			t.Fatalf("cannot pluck names: %s", err)
+		}
+		if !reflect.DeepEqual(names, []string{"john", "bob", "mike"}) {
+			t.Fatalf("unexpected names: %v", names)
+		}
+
+		ids := make([]int64, 0)
+		q := session.Table("posts").Query().Distinct().Where(Lt("user_id", 10)).OrderBy("user_id")
+		if err := q.Pluck("user_id", &ids); err != nil {
+			t.Fatalf("cannot pluck ids: %s", err)
+		}
+		if !reflect.DeepEqual(ids, []int64{1, 2}) {
+			t.Fatalf("unexpected distinct ids: %v", ids)
+		}
+
+		posts := make([]PostWithUser, 0)
+		q = session.Table("posts").Query().
+			Join("users", "users.id = posts.user_id").
+			Select("title", "users.name").
+			Distinct()
+		if err := q.All(&posts); err != nil {
+			t.Fatalf("cannot query posts: %s", err)
+		}
+		for _, post := range posts {
+			if post.Id != 0 || post.User.Id != 0 || post.Title == "" || post.User.Name == "" {
+				t.Fatalf("unexpected columns fetched: %#v", post)
+			}
+		}
+
+		err := session.Table("users").Query().Select("unknown").All(&users)
+		if !errors.Is(err, ErrInvalidItem) {
+			t.Fatalf("expected invalid item error, got %v", err)
+		}
+	})
+}
+
+func TestQueryUpdateDelete(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		_, err := session.Table("users").Query().Where(Lt("age", 40)).Update(map[string]interface{}{
+			"age":  40,
+			"name": "young",
+		})
+		if err == nil {
+			t.Fatal("names of multiple users should not be updated to the same unique value")
+		}
+		if err := session.Rollback(); err != nil {
+			t.Fatalf("cannot rollback: %s", err)
+		}
+
+		updated, err := session.Table("users").Query().Where(Lt("age", 40)).Update(map[string]interface{}{"age": 40})
+		if err != nil {
+			t.Fatalf("cannot update users: %s", err)
+		}
+		if updated != 2 {
+			t.Fatalf("expected 2 updated users, got %d", updated)
+		}
+		if count, _ := session.Table("users").Query().Where("age =", 40).Count(); count != 2 {
+			t.Fatalf("expected 2 users of age 40, got %d", count)
+		}
+
+		deleted, err := session.Table("posts").Query().Where(Not(In("user_id", []int{1, 2}))).Delete()
+		if err != nil {
+			t.Fatalf("cannot delete posts: %s", err)
+		}
+		if deleted != 1 {
+			t.Fatalf("expected 1 deleted post, got %d", deleted)
+		}
+		if count, _ := session.Table("posts").Query().Count(); count != 3 {
+			t.Fatalf("expected 3 posts left, got %d", count)
+		}
+
+		_, err = session.Table("users").Query().Update(map[string]interface{}{"unknown": 1})
+		if !errors.Is(err, ErrInvalidItem) {
+			t.Fatalf("expected invalid item error, got %v", err)
+		}
+		_, err = session.Table("users").Query().Limit(1).Delete()
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("expected invalid query error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	belongsTo  = "belongs_to"
+	hasOne     = "has_one"
+	hasMany    = "has_many"
+	manyToMany = "many_to_many"
+)
+
+// maximum number of keys loaded by single preload query
+const preloadChunkSize = 500
+
+// relation describes struct field holding related rows of another table. It
+// is declared with `rel` struct tag:
+//
+//	Author *User   `rel:"belongs_to,table=users,fk=author_id"`
+//	Avatar *Image  `rel:"has_one,table=images,fk=user_id"`
+//	Posts  []Post  `rel:"has_many,table=posts,fk=user_id"`
+//	Tags   []*Tag  `rel:"many_to_many,table=tags,join=post_tags,fk=post_id,ref=tag_id"`
+//
+// For belongs_to fk is the column of own table, referencing primary key of
+// related table, and defaults to field name followed by "_id". For has_one
+// and has_many fk is the column of related table, referencing own primary
+// key. For many_to_many, fk and ref are columns of join table, referencing
+// own and related primary key respectively. Table defaults to field name.
+//
+// Related rows are loaded with Query.Preload.
+type relation struct {
+	name  string
+	kind  string
+	index []int
+	table string
+	fk    string
+	join  string
+	ref   string
+	// type of related struct and how it is stored in the field
+	elem  reflect.Type
+	slice bool
+	ptr   bool
+}
+
+func relationOf(tp reflect.Type, name string) (*relation, error) {
+	sf, ok := tp.FieldByName(name)
+	if !ok || sf.Tag.Get("rel") == "" {
+		return nil, fmt.Errorf("%w: %s has no relation %s", ErrInvalidRelation, tp, name)
+	}
+	rel := &relation{
+		name:  name,
+		index: sf.Index,
+		table: camelToDash(name),
+	}
+	opts := strings.Split(sf.Tag.Get("rel"), ",")
+	rel.kind = opts[0]
+	for _, opt := range opts[1:] {
+		kv := strings.SplitN(opt, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%w: invalid option %q of %s", ErrInvalidRelation, opt, name)
+		}
+		switch kv[0] {
+		case "table":
+			rel.table = kv[1]
+		case "fk":
+			rel.fk = kv[1]
+		case "join":
+			rel.join = kv[1]
+		case "ref":
+			rel.ref = kv[1]
+		default:
+			return nil, fmt.Errorf("%w: invalid option %q of %s", ErrInvalidRelation, opt, name)
+		}
+	}
+
+	rel.elem = sf.Type
+	if rel.elem.Kind() == reflect.Slice {
+		rel.slice = true
+		rel.elem = rel.elem.Elem()
+	}
+	if rel.elem.Kind() == reflect.Ptr {
+		rel.ptr = true
+		rel.elem = rel.elem.Elem()
+	}
+	if rel.elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %s does not hold structures", ErrInvalidRelation, name)
+	}
+
+	switch rel.kind {
+	case belongsTo:
+		if rel.fk == "" {
+			rel.fk = camelToDash(name) + "_id"
+		}
+	case hasOne, hasMany:
+		if rel.fk == "" {
+			return nil, fmt.Errorf("%w: fk of %s is not set", ErrInvalidRelation, name)
+		}
+	case manyToMany:
+		if rel.join == "" || rel.fk == "" || rel.ref == "" {
+			return nil, fmt.Errorf("%w: join, fk and ref of %s must be set", ErrInvalidRelation, name)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown kind %q of %s", ErrInvalidRelation, rel.kind, name)
+	}
+	if rel.slice != (rel.kind == hasMany || rel.kind == manyToMany) {
+		return nil, fmt.Errorf("%w: type of %s does not match %s", ErrInvalidRelation, name, rel.kind)
+	}
+	return rel, nil
+}
+
+// preload loads related rows of all given relations and attaches them to
+// parents, which are addressable struct values fetched by the query.
+func (q *Query) preload(parents []reflect.Value) error {
+	if len(q.preloads) == 0 || len(parents) == 0 {
+		return nil
+	}
+	table, err := q.mapping.tableinfo()
+	if err != nil {
+		return err
+	}
+	fields := structmapFor(table, parents[0].Type())
+	for _, name := range q.preloads {
+		rel, err := relationOf(parents[0].Type(), name)
+		if err != nil {
+			return err
+		}
+		if err := q.loadRelation(rel, fields, parents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Query) loadRelation(rel *relation, parentFields *structmap, parents []reflect.Value) error {
+	session := q.mapping.session
+	related, err := session.Table(rel.table).tableinfo()
+	if err != nil {
+		return err
+	}
+	relatedFields := structmapFor(related, rel.elem)
+	if len(relatedFields.fields) == 0 {
+		return fmt.Errorf("%w: %s does not map table %s", ErrInvalidRelation, rel.elem, rel.table)
+	}
+
+	// parent field holding the key and column of related rows it matches
+	var parentKey *fieldmap
+	var matchTable, matchColumn string
+	switch rel.kind {
+	case belongsTo:
+		for _, f := range parentFields.fields {
+			if f.column.dbname == rel.fk {
+				parentKey = f
+			}
+		}
+		if len(related.pkfields) != 1 {
+			return fmt.Errorf("%w: table %s must have single column primary key", ErrInvalidRelation, rel.table)
+		}
+		matchTable, matchColumn = rel.table, related.pkfields[0].dbname
+	case hasOne, hasMany:
+		if len(parentFields.pk) == 1 && len(parentFields.key) == 1 {
+			parentKey = parentFields.pk[0]
+		}
+		matchTable, matchColumn = rel.table, rel.fk
+	case manyToMany:
+		if len(parentFields.pk) == 1 && len(parentFields.key) == 1 {
+			parentKey = parentFields.pk[0]
+		}
+		if len(related.pkfields) != 1 {
+			return fmt.Errorf("%w: table %s must have single column primary key", ErrInvalidRelation, rel.table)
+		}
+		matchTable, matchColumn = rel.join, rel.fk
+	}
+	if parentKey == nil {
+		return fmt.Errorf("%w: %s does not map key of %s", ErrInvalidRelation, parentFields.table.name, rel.name)
+	}
+
+	// group parents by value of their key, rows with no key have nothing
+	// related to them. Nullable keys are grouped by value they point to.
+	groups := make(map[interface{}][]reflect.Value)
+	keys := make([]interface{}, 0, len(parents))
+	keyType := parents[0].FieldByIndex(parentKey.index).Type()
+	for keyType.Kind() == reflect.Ptr {
+		keyType = keyType.Elem()
+	}
+	for _, parent := range parents {
+		key := parent.FieldByIndex(parentKey.index)
+		for key.Kind() == reflect.Ptr && !key.IsNil() {
+			key = key.Elem()
+		}
+		if key.IsZero() {
+			continue
+		}
+		if _, ok := groups[key.Interface()]; !ok {
+			keys = append(keys, key.Interface())
+		}
+		groups[key.Interface()] = append(groups[key.Interface()], parent)
+	}
+
+	for len(keys) > 0 {
+		chunk := keys
+		if len(chunk) > preloadChunkSize {
+			chunk = keys[:preloadChunkSize]
+		}
+		keys = keys[len(chunk):]
+
+		sqlquery := newSQLBuilder(session.dialect)
+		sqlquery.write("SELECT ").qualified(matchTable, matchColumn)
+		for _, column := range relatedFields.columns() {
+			sqlquery.write(", ").qualified(rel.table, column)
+		}
+		sqlquery.write(" FROM ").ident(rel.table)
+		if rel.kind == manyToMany {
+			sqlquery.write(" JOIN ").ident(rel.join).write(" ON ").qualified(rel.join, rel.ref)
+			sqlquery.write(" = ").qualified(rel.table, related.pkfields[0].dbname)
+		}
+		sqlquery.write(" WHERE ").qualified(matchTable, matchColumn)
+		sqlquery.write(" IN (").arglist(chunk).write(")")
+		if column := session.Table(rel.table).deletedColumn(related); column != "" {
+			// rows marked as deleted are not related to anything
+			sqlquery.write(" AND ").qualified(rel.table, column).write(" IS NULL")
+		}
+
+		rows, err := q.query(sqlquery)
+		if err != nil {
+			session.log.Error("preload query error: %s\n%s", err, sqlquery)
+			return err
+		}
+		key := reflect.New(keyType)
+		sqlargs := make([]interface{}, len(relatedFields.fields)+1)
+		sqlargs[0] = key.Interface()
+		for rows.Next() {
+			item := reflect.New(rel.elem)
+			relatedFields.scanargs(item.Elem(), sqlargs[1:])
+			if err := rows.Scan(sqlargs...); err != nil {
+				rows.Close()
+				session.log.Error("cannot scan related row: %s", err)
+				return err
+			}
+			for _, parent := range groups[key.Elem().Interface()] {
+				rel.attach(parent, item)
+			}
+		}
+		err = q.rowsErr(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attach stores related item (pointer to struct) in relation field of parent
+func (rel *relation) attach(parent reflect.Value, item reflect.Value) {
+	field := parent.FieldByIndex(rel.index)
+	if !rel.ptr {
+		item = item.Elem()
+	}
+	if rel.slice {
+		field.Set(reflect.Append(field, item))
+	} else {
+		field.Set(item)
+	}
+}
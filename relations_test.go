@@ -0,0 +1,132 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+type Tag struct {
+	Id   int64
+	Name string
+}
+
+type Post struct {
+	Id     int64
+	UserId int64
+	Title  string
+	Author *User  `rel:"belongs_to,table=users,fk=user_id"`
+	Tags   []*Tag `rel:"many_to_many,join=post_tags,fk=post_id,ref=tag_id"`
+}
+
+type DraftPost struct {
+	Id     int64
+	UserId *int64
+	Title  string
+	Author *User `rel:"belongs_to,table=users,fk=user_id"`
+}
+
+type Author struct {
+	Id    int64
+	Name  string
+	Posts []Post `rel:"has_many,table=posts,fk=user_id"`
+	Last  *Post  `rel:"has_one,table=posts,fk=user_id"`
+}
+
+func TestPreload(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+
+		// has many
+		authors := make([]*Author, 0)
+		q := session.Table("users").Query().OrderBy("id").Preload("Posts")
+		if err := q.All(&authors); err != nil {
+			t.Fatalf("cannot query users: %s", err)
+		}
+		if len(authors) != 3 {
+			t.Fatalf("expected 3 users, got %d", len(authors))
+		}
+		counts := []int{2, 1, 0}
+		for i, author := range authors {
+			if len(author.Posts) != counts[i] {
+				t.Fatalf("expected %s to have %d posts, got %d", author.Name, counts[i], len(author.Posts))
+			}
+			for _, post := range author.Posts {
+				if post.UserId != author.Id || post.Title == "" {
+					t.Fatalf("invalid post of %s: %#v", author.Name, post)
+				}
+			}
+		}
+
+		// belongs to and many to many
+		posts := make([]Post, 0)
+		q = session.Table("posts").Query().OrderBy("id").Preload("Author", "Tags")
+		if err := q.All(&posts); err != nil {
+			t.Fatalf("cannot query posts: %s", err)
+		}
+		if len(posts) != 4 {
+			t.Fatalf("expected 4 posts, got %d", len(posts))
+		}
+		authorNames := []string{"bob", "bob", "mike", ""}
+		tagCounts := []int{2, 0, 1, 0}
+		for i, post := range posts {
+			if authorNames[i] == "" {
+				if post.Author != nil {
+					t.Fatalf("post %d should have no author, got %#v", post.Id, post.Author)
+				}
+			} else if post.Author == nil || post.Author.Name != authorNames[i] {
+				t.Fatalf("expected post %d author to be %s, got %#v", post.Id, authorNames[i], post.Author)
+			}
+			if len(post.Tags) != tagCounts[i] {
+				t.Fatalf("expected post %d to have %d tags, got %d", post.Id, tagCounts[i], len(post.Tags))
+			}
+		}
+		if posts[0].Author != posts[1].Author {
+			t.Fatal("posts of the same author should share it")
+		}
+
+		// single row
+		post := &Post{}
+		if err := session.Table("posts").Query().Where("id =", 3).Preload("Tags").One(post); err != nil {
+			t.Fatalf("cannot query post: %s", err)
+		}
+		if len(post.Tags) != 1 || post.Tags[0].Name != "sql" {
+			t.Fatalf("unexpected tags: %#v", post.Tags)
+		}
+
+		author := &Author{}
+		if err := session.Table("users").Query().Where("id =", 2).Preload("Last").One(author); err != nil {
+			t.Fatalf("cannot query user: %s", err)
+		}
+		if author.Last == nil || author.Last.Title != "third" {
+			t.Fatalf("unexpected has one relation: %#v", author.Last)
+		}
+
+		// nullable foreign key
+		if _, err := session.Exec("INSERT INTO posts(id, user_id, title) VALUES(5, NULL, 'draft')"); err != nil {
+			t.Fatalf("cannot insert post: %s", err)
+		}
+		drafts := make([]DraftPost, 0)
+		if err := session.Table("posts").Query().OrderBy("id").Preload("Author").All(&drafts); err != nil {
+			t.Fatalf("cannot query posts: %s", err)
+		}
+		authorNames = []string{"bob", "bob", "mike", "", ""}
+		if len(drafts) != len(authorNames) {
+			t.Fatalf("expected %d posts, got %d", len(authorNames), len(drafts))
+		}
+		for i, post := range drafts {
+			if authorNames[i] == "" {
+				if post.Author != nil {
+					t.Fatalf("post %d should have no author, got %#v", post.Id, post.Author)
+				}
+			} else if post.Author == nil || post.Author.Name != authorNames[i] {
+				t.Fatalf("expected post %d author to be %s, got %#v", post.Id, authorNames[i], post.Author)
+			}
+		}
+
+		err := session.Table("users").Query().Preload("Unknown").All(&authors)
+		if !errors.Is(err, ErrInvalidRelation) {
+			t.Fatalf("expected invalid relation error, got %v", err)
+		}
+	})
+}
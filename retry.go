@@ -0,0 +1,78 @@
+package db
+
+import (
+	"math/rand"
+	"time"
+)
+
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times transaction is run
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It is doubled with
+	// every next attempt, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// OnRetry, if not nil, is called before every retry with number of the
+	// attempt that failed and its error.
+	OnRetry func(attempt int, err error)
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// RetryTransaction works like Transaction, but when fn fails with an error
+// that dialect considers transient (see Dialect.Retryable), the whole
+// transaction is rolled back and run again, after exponentially growing
+// randomized delay. fn must be safe to run multiple times.
+//
+// Only transaction begun by the call can be retried, so calls made while
+// transaction is in progress (see Transaction) behave just like Transaction.
+func (s *Session) RetryTransaction(policy RetryPolicy, fn func(s *Session) error) error {
+	if s.active() {
+		return s.Transaction(fn)
+	}
+	ctx := s.context()
+	for attempt := 1; ; attempt++ {
+		err := s.Transaction(fn)
+		if err == nil || attempt >= policy.MaxAttempts || !s.dialect.Retryable(err) {
+			return err
+		}
+		s.log.Warn("transaction failed (attempt %d of %d), retrying: %s",
+			attempt, policy.MaxAttempts, err)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err)
+		}
+
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return s.canceled(ctx, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// delay returns time to wait before next attempt. Half of the exponential
+// delay is randomized, so that competing transactions do not retry at the
+// same time.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && i < 32; i++ {
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
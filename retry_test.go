@@ -0,0 +1,144 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+type fakeStateError string
+
+func (e fakeStateError) Error() string {
+	return "pq: " + string(e)
+}
+
+func (e fakeStateError) SQLState() string {
+	return string(e)
+}
+
+func TestRetryable(t *testing.T) {
+	cases := []struct {
+		dialect   Dialect
+		err       error
+		retryable bool
+	}{
+		{Sqlite3Dialect, sqlite3.Error{Code: sqlite3.ErrBusy}, true},
+		{Sqlite3Dialect, sqlite3.Error{Code: sqlite3.ErrLocked}, true},
+		{Sqlite3Dialect, sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{Sqlite3Dialect, nil, false},
+		{PostgresDialect, fakeStateError("40001"), true},
+		{PostgresDialect, fakeStateError("40P01"), true},
+		{PostgresDialect, fakeStateError("23505"), false},
+		{PostgresDialect, errors.New("40001"), false},
+		{MySQLDialect, errors.New("Error 1213 (40001): Deadlock found"), true},
+		{MySQLDialect, errors.New("Error 1205: Lock wait timeout exceeded"), true},
+		{MySQLDialect, errors.New("Error 1062: Duplicate entry"), false},
+	}
+	for _, c := range cases {
+		if retryable := c.dialect.Retryable(c.err); retryable != c.retryable {
+			t.Errorf("%T: expected %v to be retryable: %v", c.dialect, c.err, c.retryable)
+		}
+	}
+}
+
+func TestRetryTransaction(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+		retries := make([]int, 0)
+		policy.OnRetry = func(attempt int, err error) {
+			retries = append(retries, attempt)
+		}
+
+		attempts := 0
+		err := session.RetryTransaction(policy, func(s *Session) error {
+			attempts++
+			if attempts < 3 {
+				return fakeStateError("40001")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("transaction should succeed on third attempt: %s", err)
+		}
+		if len(retries) != 2 || retries[0] != 1 || retries[1] != 2 {
+			t.Fatalf("unexpected retries: %v", retries)
+		}
+
+		// give up after max attempts
+		attempts = 0
+		err = session.RetryTransaction(policy, func(s *Session) error {
+			attempts++
+			return fakeStateError("40001")
+		})
+		if err != fakeStateError("40001") || attempts != 3 {
+			t.Fatalf("expected to fail after 3 attempts, got %d: %v", attempts, err)
+		}
+
+		// other errors are not retried
+		attempts = 0
+		err = session.RetryTransaction(policy, func(s *Session) error {
+			attempts++
+			return ErrNotFound
+		})
+		if err != ErrNotFound || attempts != 1 {
+			t.Fatalf("expected to fail after first attempt, got %d: %v", attempts, err)
+		}
+
+		// transaction begun by caller is not retried nor finished
+		if err := session.Begin(); err != nil {
+			t.Fatalf("cannot begin transaction: %s", err)
+		}
+		if _, err := session.Exec("UPDATE users SET name = $1", "outer"); err != nil {
+			t.Fatalf("cannot update users: %s", err)
+		}
+		fake.reset()
+		attempts = 0
+		err = session.RetryTransaction(policy, func(s *Session) error {
+			attempts++
+			return fakeStateError("40001")
+		})
+		if err != fakeStateError("40001") || attempts != 1 {
+			t.Fatalf("expected to fail after first attempt, got %d: %v", attempts, err)
+		}
+		if last := fake.last(); last.query != "RELEASE SAVEPOINT sp1" || !session.active() {
+			t.Fatalf("only savepoint should be rolled back, last statement %q", last.query)
+		}
+		if err := session.Rollback(); err != nil {
+			t.Fatalf("cannot rollback: %s", err)
+		}
+
+		// waiting for next attempt is interrupted by canceled context
+		ctx, cancel := context.WithCancel(context.Background())
+		policy.BaseDelay = time.Hour
+		err = session.WithContext(ctx).RetryTransaction(policy, func(s *Session) error {
+			cancel()
+			return fakeStateError("40001")
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled error, got %v", err)
+		}
+	})
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond}
+	bounds := []struct {
+		min, max time.Duration
+	}{
+		{5 * time.Millisecond, 10 * time.Millisecond},
+		{10 * time.Millisecond, 20 * time.Millisecond},
+		{20 * time.Millisecond, 40 * time.Millisecond},
+		{25 * time.Millisecond, 50 * time.Millisecond},
+		{25 * time.Millisecond, 50 * time.Millisecond},
+	}
+	for i, b := range bounds {
+		for n := 0; n < 100; n++ {
+			if delay := policy.delay(i + 1); delay < b.min || delay > b.max {
+				t.Fatalf("attempt %d: delay %s out of [%s, %s]", i+1, delay, b.min, b.max)
+			}
+		}
+	}
+}
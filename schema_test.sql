@@ -9,3 +9,74 @@ INSERT INTO users(id, name, age) VALUES
 	(2, 'mike', 25),
 	(3, 'john', 55)
 ;
+
+CREATE TABLE memberships(
+	user_id INTEGER NOT NULL,
+	tenant_id INTEGER NOT NULL,
+	role STRING,
+	PRIMARY KEY (tenant_id, user_id))
+;
+
+INSERT INTO memberships(tenant_id, user_id, role) VALUES
+	(1, 1, 'admin'),
+	(1, 2, 'member')
+;
+
+CREATE TABLE posts(
+	id INTEGER NOT NULL PRIMARY KEY,
+	user_id INTEGER,
+	title STRING)
+;
+
+INSERT INTO posts(id, user_id, title) VALUES
+	(1, 1, 'first'),
+	(2, 1, 'second'),
+	(3, 2, 'third'),
+	(4, 99, 'orphan')
+;
+
+CREATE TABLE tags(
+	id INTEGER NOT NULL PRIMARY KEY,
+	name STRING)
+;
+
+INSERT INTO tags(id, name) VALUES
+	(1, 'go'),
+	(2, 'sql')
+;
+
+CREATE TABLE post_tags(
+	post_id INTEGER NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (post_id, tag_id))
+;
+
+INSERT INTO post_tags(post_id, tag_id) VALUES
+	(1, 1),
+	(1, 2),
+	(3, 2)
+;
+
+CREATE TABLE articles(
+	id INTEGER NOT NULL PRIMARY KEY,
+	title STRING UNIQUE,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP)
+;
+
+CREATE TABLE accounts(
+	id INTEGER NOT NULL PRIMARY KEY,
+	name STRING,
+	deleted_at TIMESTAMP)
+;
+
+INSERT INTO accounts(id, name, deleted_at) VALUES
+	(1, 'active', NULL),
+	(2, 'closed', '2020-01-01 00:00:00+00:00')
+;
+
+CREATE TABLE documents(
+	id INTEGER NOT NULL PRIMARY KEY,
+	body STRING,
+	version INTEGER NOT NULL DEFAULT 0)
+;
@@ -2,16 +2,38 @@ package db
 
 import (
 	"bufio"
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"sync"
+	"time"
 )
 
+// Session is a unit of work bound to a single transaction.
+//
+// Session can be used by multiple goroutines at once, but all of them share
+// the same transaction, so that work of one can be committed or rolled back
+// by another, and statement fails with sql.ErrTxDone if transaction it was
+// run in is finished meanwhile. Transaction and RetryTransaction must not be
+// called by multiple goroutines sharing session at once, as they cannot tell
+// each other's calls from nested ones. Use Fork to get independent session
+// for every goroutine (for example for every HTTP request).
 type Session struct {
-	db      *sql.DB
-	tx      *sql.Tx
-	log     *logger
-	dialect Dialect
+	db         *sql.DB
+	log        *logger
+	dialect    Dialect
+	autocommit bool
+	clock      func() time.Time
+
+	// lock guards transaction state
+	lock  sync.Mutex
+	tx    *sql.Tx
+	ctx   context.Context
+	// number of savepoints created, so that their names are never reused
+	savepoints int
 }
 
 func Use(db *sql.DB, dialect Dialect) *Session {
@@ -22,6 +44,17 @@ func Use(db *sql.DB, dialect Dialect) *Session {
 	}
 }
 
+// UseAutocommit returns session in autocommit mode. Unlike session returned
+// by Use, which implicitly begins transaction with the first statement and
+// keeps it open until Commit or Rollback is called, every statement is
+// committed right away, unless transaction was explicitly started with Begin
+// or Transaction.
+func UseAutocommit(db *sql.DB, dialect Dialect) *Session {
+	s := Use(db, dialect)
+	s.autocommit = true
+	return s
+}
+
 func ExecFile(db *sql.DB, filepath string) error {
 	fd, err := os.Open(filepath)
 	if err != nil {
@@ -59,9 +92,60 @@ func ExecFile(db *sql.DB, filepath string) error {
 	}
 }
 
-func (s *Session) transaction() (*sql.Tx, error) {
+// Fork returns new session that shares database handle, dialect, logger and
+// context with s, but has its own transaction.
+func (s *Session) Fork() *Session {
+	return &Session{
+		db:         s.db,
+		log:        s.log,
+		dialect:    s.dialect,
+		autocommit: s.autocommit,
+		clock:      s.clock,
+		ctx:        s.context(),
+	}
+}
+
+// WithClock sets function returning current time, used to fill timestamp
+// fields of saved items (see structmap). Returns the same session.
+func (s *Session) WithClock(clock func() time.Time) *Session {
+	s.clock = clock
+	return s
+}
+
+func (s *Session) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock()
+}
+
+// WithContext sets context used by all statements executed by the session,
+// including those run by table mappings and queries. Returns the same
+// session.
+func (s *Session) WithContext(ctx context.Context) *Session {
+	s.lock.Lock()
+	s.ctx = ctx
+	s.lock.Unlock()
+	return s
+}
+
+func (s *Session) context() context.Context {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// transaction returns current transaction, beginning a new one if there is
+// none. Transaction is bound to given context and is rolled back as soon as
+// context is done.
+func (s *Session) transaction(ctx context.Context) (*sql.Tx, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	if s.tx == nil {
-		tx, err := s.db.Begin()
+		tx, err := s.db.BeginTx(ctx, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -70,38 +154,124 @@ func (s *Session) transaction() (*sql.Tx, error) {
 	return s.tx, nil
 }
 
+type executor interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}
+
+// executor returns what the next statement should be run with: transaction
+// in progress or, in autocommit mode, database handle if there is none.
+// Transaction is returned also on its own, nil if statement is not run in
+// one.
+func (s *Session) executor(ctx context.Context) (executor, *sql.Tx, error) {
+	s.lock.Lock()
+	if s.tx == nil && s.autocommit {
+		s.lock.Unlock()
+		return s.db, nil, nil
+	}
+	s.lock.Unlock()
+	tx, err := s.transaction(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tx, tx, nil
+}
+
+// Begin starts transaction, unless there is one in progress already. In
+// autocommit mode all following statements are run within it, until Commit
+// or Rollback is called.
+func (s *Session) Begin() error {
+	ctx := s.context()
+	if _, err := s.transaction(ctx); err != nil {
+		return s.canceled(ctx, err)
+	}
+	return nil
+}
+
+// canceled rolls back current transaction if err was caused by done context,
+// so that the session can be used again. Returned error always wraps context
+// error in such case.
+func (s *Session) canceled(ctx context.Context, err error) error {
+	return s.canceledTx(ctx, nil, err)
+}
+
+// canceledTx works like canceled for error of statement run in given
+// transaction. Session transaction is dropped only if it is the same one,
+// as another goroutine might have begun a new one in the meantime. Nil tx
+// stands for the current one, but then it is not dropped because of
+// sql.ErrTxDone.
+func (s *Session) canceledTx(ctx context.Context, tx *sql.Tx, err error) error {
+	if err == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// transaction of statement might have been finished and replaced by
+	// another one already
+	current := tx == nil || s.tx == tx
+	if tx != nil && current && errors.Is(err, sql.ErrTxDone) {
+		// transaction was rolled back when its context was done
+		s.tx = nil
+	}
+	ctxerr := ctx.Err()
+	if ctxerr == nil {
+		return err
+	}
+	if s.tx != nil && current {
+		s.tx.Rollback()
+		s.tx = nil
+	}
+	if errors.Is(err, ctxerr) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ctxerr, err)
+}
+
 func (s *Session) Exec(query string, args ...interface{}) (sql.Result, error) {
-	tx, err := s.transaction()
+	return s.ExecContext(s.context(), query, args...)
+}
+
+func (s *Session) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ex, tx, err := s.executor(ctx)
 	if err != nil {
-		return nil, err
+		return nil, s.canceled(ctx, err)
 	}
 	s.log.Debug("Exec: %s  =>  %#v", query, args)
-	res, err := tx.Exec(query, args...)
+	res, err := ex.ExecContext(ctx, query, args...)
 	if err != nil {
 		s.log.Warn("Exec error: %s", err)
+		return res, s.canceledTx(ctx, tx, err)
 	}
-	return res, err
+	return res, nil
 }
 
 func (s *Session) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	tx, err := s.transaction()
+	return s.QueryContext(s.context(), query, args...)
+}
+
+func (s *Session) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ex, tx, err := s.executor(ctx)
 	if err != nil {
-		return nil, err
+		return nil, s.canceled(ctx, err)
 	}
 	s.log.Debug("Query: %s  =>  %#v", query, args)
-	rows, err := tx.Query(query, args...)
+	rows, err := ex.QueryContext(ctx, query, args...)
 	if err != nil {
 		s.log.Warn("Query error: %s", err)
+		return rows, s.canceledTx(ctx, tx, err)
 	}
-	return rows, err
+	return rows, nil
 }
 
 func (s *Session) Commit() error {
-	if s.tx == nil {
+	s.lock.Lock()
+	tx := s.tx
+	s.tx = nil
+	s.lock.Unlock()
+	if tx == nil {
 		return nil
 	}
-	err := s.tx.Commit()
-	s.tx = nil
+	err := tx.Commit()
 	if err != nil {
 		s.log.Warn("Commit error: %s", err)
 	}
@@ -109,17 +279,88 @@ func (s *Session) Commit() error {
 }
 
 func (s *Session) Rollback() error {
-	if s.tx == nil {
+	s.lock.Lock()
+	tx := s.tx
+	s.tx = nil
+	s.lock.Unlock()
+	if tx == nil {
 		return nil
 	}
-	err := s.tx.Rollback()
-	s.tx = nil
+	err := tx.Rollback()
 	if err != nil {
 		s.log.Warn("Rollback error: %s", err)
 	}
 	return err
 }
 
+// Transaction runs fn within a transaction, which is committed when fn
+// returns nil and rolled back when it returns error or panics. Calls made
+// while transaction is in progress, whether begun by outer Transaction, Begin
+// or implicitly by earlier statement, are run within a savepoint, so that
+// failure of fn rolls back only work done by it and leaves decision about
+// the whole transaction to the one that began it.
+func (s *Session) Transaction(fn func(s *Session) error) (err error) {
+	s.lock.Lock()
+	nested := s.tx != nil
+	if nested {
+		s.savepoints++
+	}
+	savepoint := fmt.Sprintf("sp%d", s.savepoints)
+	s.lock.Unlock()
+
+	if nested {
+		return s.savepoint(savepoint, fn)
+	}
+	if _, err := s.transaction(s.context()); err != nil {
+		return s.canceled(s.context(), err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			s.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			s.Rollback()
+			return
+		}
+		err = s.Commit()
+	}()
+	return fn(s)
+}
+
+func (s *Session) savepoint(name string, fn func(s *Session) error) (err error) {
+	if !s.active() {
+		// outer transaction was rolled back already
+		return sql.ErrTxDone
+	}
+	if _, err := s.Exec(s.dialect.Savepoint(name)); err != nil {
+		return err
+	}
+	defer func() {
+		p := recover()
+		// transaction might be already gone if context was canceled
+		if s.active() {
+			if p != nil || err != nil {
+				s.Exec(s.dialect.RollbackToSavepoint(name))
+			}
+			if _, rerr := s.Exec(s.dialect.ReleaseSavepoint(name)); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+		if p != nil {
+			panic(p)
+		}
+	}()
+	return fn(s)
+}
+
+// active tells if session has transaction in progress
+func (s *Session) active() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.tx != nil
+}
+
 func (s *Session) Table(name string) *TableMapping {
 	return &TableMapping{
 		session: s,
@@ -1,11 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
@@ -89,3 +92,355 @@ func TestSessionQuery(t *testing.T) {
 		}
 	})
 }
+
+func TestSessionContext(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		if _, err := session.Exec("INSERT INTO users(name) VALUES(?)", "garry"); err != nil {
+			t.Fatalf("cannot insert user: %s", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := session.ExecContext(ctx, "INSERT INTO users(name) VALUES(?)", "jim")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled error, got %v", err)
+		}
+
+		// canceling must rollback whole transaction
+		if count, err := session.Table("users").Query().Count(); err != nil {
+			t.Fatalf("cannot count users: %s", err)
+		} else if count != 3 {
+			t.Fatalf("expected 3 users after rollback, got %d", count)
+		}
+
+		users := make([]*User, 0)
+		err = session.Table("users").Query().WithContext(ctx).All(&users)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled error, got %v", err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), -time.Second)
+		defer cancel()
+		_, err = session.WithContext(ctx).Table("users").Save(&User{Name: "jim"})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded error, got %v", err)
+		}
+
+		// session works again with usable context
+		session.WithContext(context.Background())
+		if _, err := session.Table("users").Save(&User{Name: "jim"}); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		if err := session.Commit(); err != nil {
+			t.Fatalf("cannot commit: %s", err)
+		}
+	})
+}
+
+func TestSessionTransaction(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		users := session.Table("users")
+		failure := errors.New("failure")
+
+		err := session.Transaction(func(s *Session) error {
+			if _, err := s.Table("users").Save(&User{Name: "jim"}); err != nil {
+				return err
+			}
+			// failing nested transaction must not affect the outer one
+			err := s.Transaction(func(s *Session) error {
+				if _, err := s.Table("users").Save(&User{Name: "tom"}); err != nil {
+					return err
+				}
+				return failure
+			})
+			if err != failure {
+				t.Fatalf("expected nested transaction error, got %v", err)
+			}
+			return s.Transaction(func(s *Session) error {
+				_, err := s.Table("users").Save(&User{Name: "ann"})
+				return err
+			})
+		})
+		if err != nil {
+			t.Fatalf("transaction failed: %s", err)
+		}
+		if session.tx != nil {
+			t.Fatal("transaction was not finished")
+		}
+		for name, expected := range map[string]bool{"jim": true, "tom": false, "ann": true} {
+			if exists, err := users.Query().Where("name =", name).Exists(); err != nil {
+				t.Fatalf("cannot check if user exists: %s", err)
+			} else if exists != expected {
+				t.Fatalf("expected user %s to exist: %v", name, expected)
+			}
+		}
+		session.Rollback()
+
+		err = session.Transaction(func(s *Session) error {
+			if _, err := s.Table("users").Save(&User{Name: "bill"}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Fatalf("expected transaction error, got %v", err)
+		}
+
+		func() {
+			defer func() {
+				if p := recover(); p != "boom" {
+					t.Fatalf("expected panic to be propagated, got %v", p)
+				}
+			}()
+			session.Transaction(func(s *Session) error {
+				s.Table("users").Save(&User{Name: "joe"})
+				panic("boom")
+			})
+		}()
+
+		for _, name := range []string{"bill", "joe"} {
+			if exists, err := users.Query().Where("name =", name).Exists(); err != nil {
+				t.Fatalf("cannot check if user exists: %s", err)
+			} else if exists {
+				t.Fatalf("user %s should be rolled back", name)
+			}
+		}
+
+		// transaction begun by caller is left for the caller to finish
+		if err := session.Begin(); err != nil {
+			t.Fatalf("cannot begin transaction: %s", err)
+		}
+		if _, err := session.Exec("INSERT INTO users(name) VALUES(?)", "outer"); err != nil {
+			t.Fatalf("cannot insert user: %s", err)
+		}
+		err = session.Transaction(func(s *Session) error {
+			_, err := s.Exec("INSERT INTO users(name) VALUES(?)", "inner")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("transaction failed: %s", err)
+		}
+		if !session.active() {
+			t.Fatal("transaction begun by caller should not be committed")
+		}
+		if err := session.Rollback(); err != nil {
+			t.Fatalf("cannot rollback: %s", err)
+		}
+		for _, name := range []string{"outer", "inner"} {
+			if exists, err := users.Query().Where("name =", name).Exists(); err != nil {
+				t.Fatalf("cannot check if user exists: %s", err)
+			} else if exists {
+				t.Fatalf("user %s should be rolled back with caller transaction", name)
+			}
+		}
+		session.Rollback()
+
+		// failure rolls back only its own work of implicit transaction
+		if _, err := session.Exec("INSERT INTO users(name) VALUES(?)", "outer"); err != nil {
+			t.Fatalf("cannot insert user: %s", err)
+		}
+		err = session.Transaction(func(s *Session) error {
+			if _, err := s.Exec("INSERT INTO users(name) VALUES(?)", "inner"); err != nil {
+				return err
+			}
+			return failure
+		})
+		if err != failure {
+			t.Fatalf("expected transaction error, got %v", err)
+		}
+		for name, expected := range map[string]bool{"outer": true, "inner": false} {
+			if exists, err := users.Query().Where("name =", name).Exists(); err != nil {
+				t.Fatalf("cannot check if user exists: %s", err)
+			} else if exists != expected {
+				t.Fatalf("expected user %s to exist: %v", name, expected)
+			}
+		}
+		session.Rollback()
+	})
+}
+
+func TestSessionFork(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		base := Use(db, Sqlite3Dialect)
+		policy := RetryPolicy{MaxAttempts: 50, BaseDelay: time.Millisecond, MaxDelay: 20 * time.Millisecond}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < cap(errs); i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				session := base.Fork()
+				errs <- session.RetryTransaction(policy, func(s *Session) error {
+					if _, err := s.Table("users").Save(&User{Name: fmt.Sprintf("user-%d", i)}); err != nil {
+						return err
+					}
+					// savepoints of concurrent sessions are independent
+					err := s.Transaction(func(s *Session) error {
+						if _, err := s.Table("users").Save(&User{Name: fmt.Sprintf("nested-%d", i)}); err != nil {
+							return err
+						}
+						return ErrNotFound
+					})
+					if err != ErrNotFound {
+						return err
+					}
+					return nil
+				})
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("cannot save user: %s", err)
+			}
+		}
+
+		if count, err := base.Table("users").Query().Count(); err != nil {
+			t.Fatalf("cannot count users: %s", err)
+		} else if count != 23 {
+			t.Fatalf("expected 23 users, got %d", count)
+		}
+	})
+}
+
+// session shared by many goroutines must not race, even though they all use
+// the same transaction. Statement fails only if transaction is committed by
+// another goroutine in the meantime.
+func TestSessionConcurrentUse(t *testing.T) {
+	withFakeConnection(t, func(db *sql.DB, fake *fakeDB) {
+		session := Use(db, &sqlite3Dialect{})
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 40)
+		for i := 0; i < cap(errs)/2; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				session.WithContext(context.Background())
+				_, err := session.Exec("UPDATE users SET age = ?", i)
+				errs <- err
+				if i%5 == 0 {
+					errs <- session.Commit()
+				} else {
+					rows, err := session.Query("SELECT age FROM users")
+					if err == nil {
+						rows.Close()
+					}
+					errs <- err
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil && !errors.Is(err, sql.ErrTxDone) {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if err := session.Commit(); err != nil {
+			t.Fatalf("cannot commit: %s", err)
+		}
+	})
+}
+
+// statement failing because its transaction was committed by another
+// goroutine must not drop transaction that goroutine began afterwards
+func TestSessionConcurrentCommit(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := Use(db, Sqlite3Dialect)
+		ctx := context.Background()
+
+		started, committed := make(chan struct{}), make(chan struct{})
+		errs := make(chan error, 1)
+		go func() {
+			// goroutine A takes transaction the way ExecContext does
+			_, tx, err := session.executor(ctx)
+			if err != nil {
+				errs <- err
+				return
+			}
+			close(started)
+			<-committed
+			_, err = tx.ExecContext(ctx, "UPDATE users SET age = 1")
+			errs <- session.canceledTx(ctx, tx, err)
+		}()
+
+		<-started
+		if err := session.Commit(); err != nil {
+			t.Fatalf("cannot commit: %s", err)
+		}
+		if _, err := session.Exec("INSERT INTO users(name) VALUES(?)", "jim"); err != nil {
+			t.Fatalf("cannot insert user: %s", err)
+		}
+		close(committed)
+		if err := <-errs; !errors.Is(err, sql.ErrTxDone) {
+			t.Fatalf("expected statement of committed transaction to fail, got %v", err)
+		}
+		if !session.active() {
+			t.Fatal("transaction begun after commit should be kept")
+		}
+		if err := session.Commit(); err != nil {
+			t.Fatalf("cannot commit: %s", err)
+		}
+		other := Use(db, Sqlite3Dialect)
+		defer other.Rollback()
+		if exists, err := other.Table("users").Query().Where("name =", "jim").Exists(); err != nil {
+			t.Fatalf("cannot check if user exists: %s", err)
+		} else if !exists {
+			t.Fatal("user should be committed")
+		}
+	})
+}
+
+func TestSessionAutocommit(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		session := UseAutocommit(db, Sqlite3Dialect)
+		other := Use(db, Sqlite3Dialect)
+		defer other.Rollback()
+
+		if _, err := session.Exec("INSERT INTO users(name) VALUES(?)", "garry"); err != nil {
+			t.Fatalf("cannot insert user: %s", err)
+		}
+		if session.active() {
+			t.Fatal("autocommit session should not begin transaction")
+		}
+		if exists, err := other.Table("users").Query().Where("name =", "garry").Exists(); err != nil {
+			t.Fatalf("cannot check if user exists: %s", err)
+		} else if !exists {
+			t.Fatal("user should be committed right away")
+		}
+		other.Rollback()
+
+		if err := session.Begin(); err != nil {
+			t.Fatalf("cannot begin transaction: %s", err)
+		}
+		if _, err := session.Exec("INSERT INTO users(name) VALUES(?)", "jim"); err != nil {
+			t.Fatalf("cannot insert user: %s", err)
+		}
+		if err := session.Rollback(); err != nil {
+			t.Fatalf("cannot rollback: %s", err)
+		}
+		if exists, err := session.Table("users").Query().Where("name =", "jim").Exists(); err != nil {
+			t.Fatalf("cannot check if user exists: %s", err)
+		} else if exists {
+			t.Fatal("user should be rolled back")
+		}
+
+		err := session.Transaction(func(s *Session) error {
+			_, err := s.Exec("INSERT INTO users(name) VALUES(?)", "tom")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("transaction failed: %s", err)
+		}
+		if exists, err := other.Table("users").Query().Where("name =", "tom").Exists(); err != nil {
+			t.Fatalf("cannot check if user exists: %s", err)
+		} else if !exists {
+			t.Fatal("user should be committed by transaction")
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// deletedColumn is the column that puts table in soft delete mode by default
+const deletedColumn = "deleted_at"
+
+// deletedScope tells which rows of table in soft delete mode query selects
+type deletedScope int
+
+const (
+	withoutDeleted deletedScope = iota
+	withDeleted
+	onlyDeleted
+)
+
+// SoftDelete puts table mapping in soft delete mode, in which rows are not
+// removed, but marked as deleted by setting given column to time of
+// deletion. Tables having deleted_at column are in this mode by default,
+// empty column turns it off. Returns the same mapping.
+//
+// Queries of table in soft delete mode skip rows marked as deleted, unless
+// WithDeleted or OnlyDeleted is used. The column is changed only by Delete
+// and Restore, items are inserted and updated without it.
+func (m *TableMapping) SoftDelete(column string) *TableMapping {
+	m.softdelete = &column
+	return m
+}
+
+// deletedColumn returns column marking deleted rows or empty string if table
+// is not in soft delete mode
+func (m *TableMapping) deletedColumn(table *tableinfo) string {
+	if m.softdelete != nil {
+		return *m.softdelete
+	}
+	if table.has(deletedColumn) {
+		return deletedColumn
+	}
+	return ""
+}
+
+// HardDelete removes row of given item, even if table is in soft delete
+// mode.
+func (m *TableMapping) HardDelete(item interface{}) error {
+	return m.delete(item, true)
+}
+
+// Restore unmarks row of given item deleted in soft delete mode.
+// ErrNotFound is returned if row does not exist or is not deleted.
+func (m *TableMapping) Restore(item interface{}) error {
+	table, err := m.tableinfo()
+	if err != nil {
+		return err
+	}
+	column := m.deletedColumn(table)
+	if column == "" {
+		return fmt.Errorf("%w: table %s is not in soft delete mode", ErrInvalidQuery, table.name)
+	}
+	val := reflect.ValueOf(item)
+	for val.Type().Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Type().Kind() != reflect.Struct {
+		return ErrInvalidItem
+	}
+	fields := structmapFor(table, val.Type())
+	keycols, keyvals, err := fields.keyvalues(val)
+	if err != nil {
+		return err
+	}
+
+	sqlquery := newSQLBuilder(m.session.dialect).update(table.name, []string{column}, []interface{}{nil})
+	sqlquery.where(append(eqConds(keycols, keyvals), Not(IsNull(column))))
+	if err := m.execOne(sqlquery); err != nil {
+		return err
+	}
+	setDeleted(fields, val, column, time.Time{})
+	return nil
+}
+
+// softDelete marks row with given key as deleted, unless it is already
+func (m *TableMapping) softDelete(table *tableinfo, column string, fields *structmap, val reflect.Value, keycols []string, keyvals []interface{}) error {
+	now := m.session.now()
+	sqlquery := newSQLBuilder(m.session.dialect)
+	sqlquery.update(table.name, []string{column}, []interface{}{m.session.dialect.FormatTime(now)})
+	sqlquery.where(append(eqConds(keycols, keyvals), IsNull(column)))
+	if err := m.execOne(sqlquery); err != nil {
+		return err
+	}
+	setDeleted(fields, val, column, now)
+	return nil
+}
+
+// setDeleted stores deletion time in field bound to given column, if it is
+// of time.Time or *time.Time type. Zero time clears it.
+func setDeleted(fields *structmap, val reflect.Value, column string, t time.Time) {
+	for _, f := range fields.fields {
+		if f.column.dbname != column {
+			continue
+		}
+		field := val.FieldByIndex(f.index)
+		switch {
+		case field.Type() == timeType:
+			field.Set(reflect.ValueOf(t))
+		case field.Type() == reflect.PtrTo(timeType) && t.IsZero():
+			field.Set(reflect.Zero(field.Type()))
+		case field.Type() == reflect.PtrTo(timeType):
+			field.Set(reflect.ValueOf(&t))
+		}
+	}
+	// row is marked in database already
+	fields.remember(val, []string{column})
+}
+
+func eqConds(columns []string, vals []interface{}) []Cond {
+	conds := make([]Cond, len(columns), len(columns)+1)
+	for i, column := range columns {
+		conds[i] = Eq(column, vals[i])
+	}
+	return conds
+}
+
+// WithDeleted makes query select also rows marked as deleted in soft delete
+// mode.
+func (q *Query) WithDeleted() *Query {
+	q.deleted = withDeleted
+	return q
+}
+
+// OnlyDeleted makes query select only rows marked as deleted in soft delete
+// mode.
+func (q *Query) OnlyDeleted() *Query {
+	q.deleted = onlyDeleted
+	return q
+}
+
+// conds returns conditions of the query, including the one skipping rows
+// marked as deleted
+func (q *Query) conds(table *tableinfo) []Cond {
+	column := q.mapping.deletedColumn(table)
+	if column == "" || q.deleted == withDeleted {
+		return q.filter
+	}
+	conds := make([]Cond, len(q.filter), len(q.filter)+1)
+	copy(conds, q.filter)
+	if q.deleted == onlyDeleted {
+		return append(conds, Not(IsNull(table.name+"."+column)))
+	}
+	return append(conds, IsNull(table.name+"."+column))
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+type Account struct {
+	Id        int64
+	Name      string
+	DeletedAt *time.Time
+}
+
+// deletion time of value type is zero for rows not deleted
+type ClosedAccount struct {
+	Id        int64
+	Name      string
+	DeletedAt time.Time
+}
+
+func TestSoftDeleteNotWritten(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		session := Use(db, Sqlite3Dialect).WithClock(func() time.Time { return now })
+		accounts := session.Table("accounts")
+		visible := func(id int64) bool {
+			exists, err := accounts.Query().Where(Eq("id", id)).Exists()
+			if err != nil {
+				t.Fatalf("cannot check if account exists: %s", err)
+			}
+			return exists
+		}
+
+		account := &ClosedAccount{Name: "new"}
+		if _, err := accounts.Save(account); err != nil {
+			t.Fatalf("cannot save account: %s", err)
+		}
+		if !visible(account.Id) {
+			t.Fatal("inserted account should not be deleted")
+		}
+
+		stale := &Account{}
+		if err := accounts.Get(stale, account.Id); err != nil {
+			t.Fatalf("cannot get account: %s", err)
+		}
+		if err := accounts.Delete(account); err != nil {
+			t.Fatalf("cannot delete account: %s", err)
+		}
+		if !account.DeletedAt.Equal(now) {
+			t.Fatalf("deletion time was not set: %v", account.DeletedAt)
+		}
+		stale.Name = "renamed"
+		if _, err := accounts.Save(stale); err != nil {
+			t.Fatalf("cannot save account: %s", err)
+		}
+		if visible(account.Id) {
+			t.Fatal("saving stale account should not restore it")
+		}
+		if err := accounts.Update(stale, "deleted_at"); !errors.Is(err, ErrInvalidItem) {
+			t.Fatalf("expected invalid item error, got %v", err)
+		}
+
+		if err := accounts.Restore(account); err != nil {
+			t.Fatalf("cannot restore account: %s", err)
+		}
+		if !account.DeletedAt.IsZero() {
+			t.Fatalf("deletion time was not cleared: %v", account.DeletedAt)
+		}
+		restored := &Account{}
+		if err := accounts.Get(restored, account.Id); err != nil {
+			t.Fatalf("cannot get restored account: %s", err)
+		}
+		if restored.Name != "renamed" {
+			t.Fatalf("stale account should be saved, got %#v", restored)
+		}
+	})
+}
+
+func TestSoftDelete(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		session := Use(db, Sqlite3Dialect).WithClock(func() time.Time { return now })
+		accounts := session.Table("accounts")
+
+		count := func(q *Query) int64 {
+			count, err := q.Count()
+			if err != nil {
+				t.Fatalf("cannot count accounts: %s", err)
+			}
+			return count
+		}
+		if n := count(accounts.Query()); n != 1 {
+			t.Fatalf("deleted accounts should be skipped, got %d", n)
+		}
+		if n := count(accounts.Query().WithDeleted()); n != 2 {
+			t.Fatalf("expected 2 accounts with deleted ones, got %d", n)
+		}
+		if n := count(accounts.Query().OnlyDeleted()); n != 1 {
+			t.Fatalf("expected 1 deleted account, got %d", n)
+		}
+		if err := accounts.Get(&Account{}, 2); err != ErrNotFound {
+			t.Fatalf("deleted account should not be found, got %v", err)
+		}
+
+		account := &Account{}
+		if err := accounts.Get(account, 1); err != nil {
+			t.Fatalf("cannot get account: %s", err)
+		}
+		if err := accounts.Delete(account); err != nil {
+			t.Fatalf("cannot delete account: %s", err)
+		}
+		if account.DeletedAt == nil || !account.DeletedAt.Equal(now) {
+			t.Fatalf("deletion time was not set: %v", account.DeletedAt)
+		}
+		if exists, _ := accounts.Query().Exists(); exists {
+			t.Fatal("all accounts should be deleted")
+		}
+		if err := accounts.Delete(account); err != ErrNotFound {
+			t.Fatalf("deleted account should not be deleted again, got %v", err)
+		}
+
+		if err := accounts.Restore(account); err != nil {
+			t.Fatalf("cannot restore account: %s", err)
+		}
+		if account.DeletedAt != nil {
+			t.Fatalf("deletion time was not cleared: %v", account.DeletedAt)
+		}
+		if n := count(accounts.Query()); n != 1 {
+			t.Fatalf("expected restored account, got %d accounts", n)
+		}
+
+		if n, err := accounts.Query().Where("name =", "active").Delete(); err != nil || n != 1 {
+			t.Fatalf("expected 1 account to be deleted, got %d (%v)", n, err)
+		}
+		if n := count(accounts.Query().OnlyDeleted()); n != 2 {
+			t.Fatalf("expected 2 deleted accounts, got %d", n)
+		}
+		if n, err := accounts.Query().OnlyDeleted().HardDelete(); err != nil || n != 2 {
+			t.Fatalf("expected 2 accounts to be removed, got %d (%v)", n, err)
+		}
+		if n := count(accounts.Query().WithDeleted()); n != 0 {
+			t.Fatalf("all accounts should be removed, got %d", n)
+		}
+
+		// explicitly configured column
+		users := session.Table("users").SoftDelete("name")
+		if n := count(users.Query()); n != 0 {
+			t.Fatalf("users with name should be treated as deleted, got %d", n)
+		}
+		if err := session.Table("users").Restore(&User{Id: 1}); !errors.Is(err, ErrInvalidQuery) {
+			t.Fatalf("expected invalid query error, got %v", err)
+		}
+		if err := session.Table("accounts").HardDelete(&Account{Id: 1}); err != ErrNotFound {
+			t.Fatalf("removed account should not be found, got %v", err)
+		}
+	})
+}
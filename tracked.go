@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Tracked, embedded in a struct, makes rows loaded into it by queries
+// remember values of their columns:
+//
+//	type User struct {
+//		db.Tracked
+//		Id   int64
+//		Name string
+//	}
+//
+// Save of tracked item then updates only columns that changed since the row
+// was loaded or last saved, and skips the UPDATE entirely if none did.
+// Columns not remembered, e.g. not fetched by query, are written only if
+// their fields are set to other than zero values. Use Update to write zero
+// values to them.
+type Tracked struct {
+	// values of columns by their names, never modified once set, so that
+	// copies of item can share it
+	snapshot map[string]interface{}
+}
+
+var trackedType = reflect.TypeOf(Tracked{})
+
+// Update writes given columns of existing row of item, identified by its
+// primary key, along with its update time and version (see structmap).
+// Other columns are left as they are in database. ErrInvalidItem is returned
+// if item does not map any of columns or cannot write it.
+func (m *TableMapping) Update(item interface{}, columns ...string) error {
+	table, err := m.tableinfo()
+	if err != nil {
+		return err
+	}
+	val := reflect.ValueOf(item)
+	for val.Type().Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Type().Kind() != reflect.Struct {
+		return ErrInvalidItem
+	}
+	fields := structmapFor(table, val.Type())
+	keycols, keyvals, err := fields.keyvalues(val)
+	if err != nil {
+		return err
+	}
+	only := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		f := fields.column(column)
+		if f == nil || f.readonly || f.pk || f.createstamp || column == m.deletedColumn(table) {
+			return fmt.Errorf("%w: %s cannot update column %s", ErrInvalidItem, val.Type(), column)
+		}
+		only[column] = true
+	}
+	if len(only) == 0 {
+		return nil
+	}
+
+	if err := beforeSave(m.session, val); err != nil {
+		return err
+	}
+	if err := m.update(table, fields, val, only, keycols, keyvals); err != nil {
+		return err
+	}
+	return afterSave(m.session, val)
+}
+
+// column returns mapping of column of given name or nil if struct does not
+// map it
+func (sm *structmap) column(name string) *fieldmap {
+	for _, f := range sm.fields {
+		if f.column.dbname == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// remember stores current values of given columns of struct value in its
+// snapshot, values of all mapped columns if columns is nil. It does nothing
+// if struct is not tracked.
+func (sm *structmap) remember(structval reflect.Value, columns []string) {
+	if sm.tracked == nil {
+		return
+	}
+	tracked := structval.FieldByIndex(sm.tracked).Addr().Interface().(*Tracked)
+	snapshot := make(map[string]interface{}, len(sm.fields))
+	if columns != nil {
+		for column, value := range tracked.snapshot {
+			snapshot[column] = value
+		}
+	}
+	for _, f := range sm.fields {
+		if columns == nil || contains(columns, f.column.dbname) {
+			snapshot[f.column.dbname] = snapshotValue(structval.FieldByIndex(f.index))
+		}
+	}
+	tracked.snapshot = snapshot
+}
+
+// snapshotValue returns copy of field value that is not affected by later
+// changes of the field, including changes of values it points to.
+func snapshotValue(f reflect.Value) interface{} {
+	switch {
+	case f.Kind() == reflect.Ptr && !f.IsNil():
+		value := reflect.New(f.Type().Elem())
+		value.Elem().Set(f.Elem())
+		return value.Interface()
+	case f.Kind() == reflect.Slice && !f.IsNil():
+		value := reflect.MakeSlice(f.Type(), f.Len(), f.Len())
+		reflect.Copy(value, f)
+		return value.Interface()
+	}
+	return f.Interface()
+}
+
+// dirty returns columns of struct value that UPDATE writes and that differ
+// from its snapshot. Columns not in snapshot are dirty if their fields are
+// not zero. tracked is false if struct is not tracked or there is no
+// snapshot, so that all columns should be written.
+func (sm *structmap) dirty(structval reflect.Value) (dirty map[string]bool, tracked bool) {
+	if sm.tracked == nil {
+		return nil, false
+	}
+	snapshot := structval.FieldByIndex(sm.tracked).Interface().(Tracked).snapshot
+	if snapshot == nil {
+		return nil, false
+	}
+	dirty = make(map[string]bool)
+	for _, f := range sm.fields {
+		if f.readonly || f.pk || f.createstamp {
+			continue
+		}
+		field := structval.FieldByIndex(f.index)
+		value, ok := snapshot[f.column.dbname]
+		if ok && !reflect.DeepEqual(value, field.Interface()) || !ok && !field.IsZero() {
+			dirty[f.column.dbname] = true
+		}
+	}
+	return dirty, true
+}
+
+// partial returns those of given columns and their values that are in only,
+// or that hold update time or version, which are written with every update.
+func (sm *structmap) partial(columns []string, args []interface{}, only map[string]bool) ([]string, []interface{}) {
+	kept, keptargs := make([]string, 0, len(only)), make([]interface{}, 0, len(only))
+	for i, column := range columns {
+		f := sm.column(column)
+		if only[column] || f.updatestamp || f.version {
+			kept = append(kept, column)
+			keptargs = append(keptargs, args[i])
+		}
+	}
+	return kept, keptargs
+}
+
+// remember stores values of row scanned into struct value in its snapshot,
+// if it is tracked.
+func (jm *joinmap) remember(structval reflect.Value) {
+	if main := jm.parts[0]; main.index == nil {
+		main.fields.remember(structval, nil)
+	}
+}
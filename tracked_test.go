@@ -0,0 +1,188 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+type TrackedUser struct {
+	Tracked
+	Id   int64
+	Name string
+	Age  int64
+}
+
+type TrackedArticle struct {
+	Tracked
+	Id        int64
+	Title     string
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
+
+func TestTrackedSave(t *testing.T) {
+	withPostgres(t, func(session *Session, fake *fakeDB) {
+		fake.on(`FROM "users"`, []string{"id", "name", "age"},
+			[]driver.Value{int64(1), "bob", int64(32)})
+		users := session.Table("users")
+
+		user := &TrackedUser{}
+		if err := users.Get(user, 1); err != nil {
+			t.Fatalf("cannot get user: %s", err)
+		}
+		fake.reset()
+		if _, err := users.Save(user); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		if queries := fake.queries(); len(queries) != 0 {
+			t.Fatalf("unchanged user should not be updated: %v", queries)
+		}
+
+		user.Name = "bobby"
+		if _, err := users.Save(user); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		expected := `UPDATE "users" SET "name" = $1 WHERE "id" = $2`
+		last := fake.last()
+		if last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		if len(last.args) != 2 || last.args[0] != "bobby" || last.args[1] != int64(1) {
+			t.Fatalf("invalid update arguments: %#v", last.args)
+		}
+		fake.reset()
+		if _, err := users.Save(user); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		if queries := fake.queries(); len(queries) != 0 {
+			t.Fatalf("saved user should not be updated again: %v", queries)
+		}
+
+		// only explicitly listed columns are written
+		user.Name, user.Age = "robert", 33
+		if err := users.Update(user, "age"); err != nil {
+			t.Fatalf("cannot update user: %s", err)
+		}
+		expected = `UPDATE "users" SET "age" = $1 WHERE "id" = $2`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		if _, err := users.Save(user); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		expected = `UPDATE "users" SET "name" = $1 WHERE "id" = $2`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+
+		if err := users.Update(user, "email"); !errors.Is(err, ErrInvalidItem) {
+			t.Fatalf("expected invalid item error for unknown column, got %v", err)
+		}
+		if err := users.Update(user, "id"); !errors.Is(err, ErrInvalidItem) {
+			t.Fatalf("expected invalid item error for key column, got %v", err)
+		}
+		if err := users.Update(&TrackedUser{Name: "jim"}, "name"); !errors.Is(err, ErrIncompleteKey) {
+			t.Fatalf("expected incomplete key error, got %v", err)
+		}
+
+		// columns not fetched are written only if set
+		fake.on(`SELECT "id", "name" FROM "users"`, []string{"id", "name"},
+			[]driver.Value{int64(1), "bob"})
+		partial := &TrackedUser{}
+		if err := users.Query().Select("id", "name").One(partial); err != nil {
+			t.Fatalf("cannot get user: %s", err)
+		}
+		partial.Name = "bobby"
+		if _, err := users.Save(partial); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		expected = `UPDATE "users" SET "name" = $1 WHERE "id" = $2`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+		partial.Age = 33
+		if _, err := users.Save(partial); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		expected = `UPDATE "users" SET "age" = $1 WHERE "id" = $2`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+
+		// items saved without being loaded write all columns
+		fresh := &User{Id: 1, Name: "bob"}
+		if _, err := users.Save(fresh); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		expected = `UPDATE "users" SET "name" = $1 WHERE "id" = $2`
+		if last := fake.last(); last.query != expected {
+			t.Fatalf("expected %q, got %q", expected, last.query)
+		}
+	})
+}
+
+func TestTrackedRows(t *testing.T) {
+	withConnection(t, func(db *sql.DB) {
+		now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		session := Use(db, Sqlite3Dialect).WithClock(func() time.Time { return now })
+		users := session.Table("users")
+
+		loaded := make([]*TrackedUser, 0)
+		if err := users.Query().OrderBy("id").All(&loaded); err != nil {
+			t.Fatalf("cannot query users: %s", err)
+		}
+		// change of column item does not modify, e.g. by another client
+		if _, err := session.Exec("UPDATE users SET age = 40 WHERE id = 1"); err != nil {
+			t.Fatalf("cannot update user: %s", err)
+		}
+		loaded[0].Name = "bobby"
+		if _, err := users.Save(loaded[0]); err != nil {
+			t.Fatalf("cannot save user: %s", err)
+		}
+		user := &TrackedUser{}
+		if err := users.Get(user, 1); err != nil {
+			t.Fatalf("cannot get user: %s", err)
+		}
+		if user.Name != "bobby" || user.Age != 40 {
+			t.Fatalf("only changed column should be written, got %#v", user)
+		}
+
+		articles := session.Table("articles")
+		article := &TrackedArticle{Title: "first"}
+		if _, err := articles.Save(article); err != nil {
+			t.Fatalf("cannot save article: %s", err)
+		}
+		now = now.Add(time.Hour)
+		// saved item is tracked as well
+		if _, err := articles.Save(article); err != nil {
+			t.Fatalf("cannot save article: %s", err)
+		}
+		it := articles.Query().Iter(article)
+		defer it.Close()
+		if !it.Next() {
+			t.Fatalf("cannot load article: %v", it.Err())
+		}
+		it.Close()
+		if _, err := articles.Save(article); err != nil {
+			t.Fatalf("cannot save article: %s", err)
+		}
+		if !article.UpdatedAt.Equal(now.Add(-time.Hour)) {
+			t.Fatalf("unchanged article should not be stamped, got %s", article.UpdatedAt)
+		}
+
+		article.Title = "changed"
+		if _, err := articles.Save(article); err != nil {
+			t.Fatalf("cannot save article: %s", err)
+		}
+		stored := &Article{}
+		if err := articles.Get(stored, article.Id); err != nil {
+			t.Fatalf("cannot get article: %s", err)
+		}
+		if stored.Title != "changed" || !stored.UpdatedAt.Equal(now) {
+			t.Fatalf("changed article should be stamped, got %#v", stored)
+		}
+	})
+}